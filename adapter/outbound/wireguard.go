@@ -22,25 +22,41 @@ import (
 	"github.com/Dreamacro/clash/component/resolver"
 	C "github.com/Dreamacro/clash/constant"
 	"github.com/Dreamacro/clash/transport/wireguard"
+	"github.com/Dreamacro/clash/transport/wireguard/kernel"
 )
 
 const dialTimeout = 10 * time.Second
 
+// defaultRoamProbeInterval is the WgBind health-check cadence used when
+// Candidates is set but ProbeInterval isn't.
+const defaultRoamProbeInterval = 30 * time.Second
+
 type WireGuard struct {
 	*Base
-	wgDevice  *device.Device
-	tunDevice tun.Device
-	netStack  *wireguard.Net
-	bind      *wireguard.WgBind
-
-	dialer     *wgDialer
-	localIP    netip.Addr
-	localIPv6  netip.Addr
-	dnsServers []netip.Addr
-	reserved   []byte
-	uapiConf   []string
-	threadId   string
-	mtu        int
+	wgDevice     *device.Device
+	tunDevice    tun.Device
+	netStack     *wireguard.Net
+	bind         *wireguard.WgBind
+	kernelDevice kernel.Device
+
+	dialer        *wgDialer
+	localIP       netip.Addr
+	localIPv6     netip.Addr
+	dnsServers    []netip.Addr
+	reserved      []byte
+	peers         []WireGuardPeerOption
+	uapiConf      []string
+	threadId      string
+	mtu           int
+	useKernel     bool
+	gso           bool
+	parallel      int
+	candidates    []string
+	probeInterval int
+	fwMark        int
+	privateKey    string
+	publicKey     string
+	presharedKey  string
 
 	upOnce   sync.Once
 	downOnce sync.Once
@@ -51,19 +67,48 @@ type WireGuard struct {
 
 type WireGuardOption struct {
 	BasicOption
-	Name             string   `proxy:"name"`
-	Server           string   `proxy:"server"`
-	Port             int      `proxy:"port"`
-	IP               string   `proxy:"ip,omitempty"`
-	IPv6             string   `proxy:"ipv6,omitempty"`
-	PrivateKey       string   `proxy:"private-key"`
-	PublicKey        string   `proxy:"public-key"`
-	PresharedKey     string   `proxy:"preshared-key,omitempty"`
-	DNS              []string `proxy:"dns,omitempty"`
-	MTU              int      `proxy:"mtu,omitempty"`
-	UDP              bool     `proxy:"udp,omitempty"`
-	RemoteDnsResolve bool     `proxy:"remote-dns-resolve,omitempty"`
-	Reserved         string   `proxy:"reserved,omitempty"`
+	Name             string                `proxy:"name"`
+	Server           string                `proxy:"server"`
+	Port             int                   `proxy:"port"`
+	IP               string                `proxy:"ip,omitempty"`
+	IPv6             string                `proxy:"ipv6,omitempty"`
+	PrivateKey       string                `proxy:"private-key"`
+	PublicKey        string                `proxy:"public-key,omitempty"`
+	PresharedKey     string                `proxy:"preshared-key,omitempty"`
+	DNS              []string              `proxy:"dns,omitempty"`
+	MTU              int                   `proxy:"mtu,omitempty"`
+	UDP              bool                  `proxy:"udp,omitempty"`
+	RemoteDnsResolve bool                  `proxy:"remote-dns-resolve,omitempty"`
+	Reserved         string                `proxy:"reserved,omitempty"`
+	Peers            []WireGuardPeerOption `proxy:"peers,omitempty"`
+	Kernel           bool                  `proxy:"kernel,omitempty"`
+	Gso              bool                  `proxy:"gso,omitempty"`
+	Parallel         int                   `proxy:"parallel,omitempty"`
+	// Candidates lists extra "host:port" endpoints for the same peer that
+	// WgBind should transparently fail over between if server:port goes
+	// quiet - it doesn't replace server/port, which stays the endpoint
+	// device.Device is configured with. Only used when Peers is empty.
+	Candidates []string `proxy:"candidates,omitempty"`
+	// ProbeInterval is how often WgBind health-checks the active candidate
+	// and probes the others, in seconds. Defaults to 30 when Candidates is
+	// set and this is left at 0.
+	ProbeInterval int `proxy:"probe-interval,omitempty"`
+}
+
+// WireGuardPeerOption configures one peer of a multi-peer WireGuard
+// outbound. When Peers is set, it replaces the single public-key/
+// preshared-key/reserved fields above and lets different destinations
+// egress via different peers on the same interface (split tunnel), by
+// longest-prefix match of the destination IP against AllowedIPs - the same
+// routing wireguard-go's device already performs internally.
+type WireGuardPeerOption struct {
+	Server              string   `proxy:"server"`
+	Port                int      `proxy:"port"`
+	PublicKey           string   `proxy:"public-key"`
+	PreSharedKey        string   `proxy:"preshared-key,omitempty"`
+	AllowedIPs          []string `proxy:"allowed-ips"`
+	Reserved            string   `proxy:"reserved,omitempty"`
+	PersistentKeepalive int      `proxy:"persistent-keepalive,omitempty"`
 }
 
 // DialContext implements C.ProxyAdapter
@@ -92,6 +137,15 @@ func (w *WireGuard) DialContext(ctx context.Context, metadata *C.Metadata, _ ...
 		remoteAddress = metadata.RemoteAddress()
 	}
 
+	if w.kernelDevice != nil {
+		d := net.Dialer{Control: kernel.MarkControl(w.fwMark)}
+		c, err := d.DialContext(dialCtx, "tcp", remoteAddress)
+		if err != nil {
+			return nil, err
+		}
+		return NewConn(&wgConn{c}, w), nil
+	}
+
 	c, err := w.netStack.DialContext(dialCtx, "tcp", remoteAddress)
 	if err != nil {
 		return nil, err
@@ -110,7 +164,7 @@ func (w *WireGuard) ListenPacketContext(ctx context.Context, metadata *C.Metadat
 	}
 
 	if !metadata.Resolved() {
-		if w.remoteDnsResolve {
+		if w.remoteDnsResolve && w.netStack != nil {
 			rAddrs, err := w.netStack.LookupContextHost(ctx, metadata.Host)
 			if err != nil {
 				return nil, err
@@ -132,6 +186,15 @@ func (w *WireGuard) ListenPacketContext(ctx context.Context, metadata *C.Metadat
 		lAddr = w.localIP
 	}
 
+	if w.kernelDevice != nil {
+		lc := net.ListenConfig{Control: kernel.MarkControl(w.fwMark)}
+		pc, err := lc.ListenPacket(ctx, "udp", net.JoinHostPort(lAddr.String(), "0"))
+		if err != nil {
+			return nil, err
+		}
+		return NewPacketConn(&wgPConn{pc}, w), nil
+	}
+
 	pc, err := w.netStack.ListenUDPAddrPort(netip.AddrPortFrom(lAddr, 0))
 	if err != nil {
 		return nil, err
@@ -148,6 +211,9 @@ func (w *WireGuard) Cleanup() {
 		if w.wgDevice != nil {
 			w.wgDevice.Close()
 		}
+		if w.kernelDevice != nil {
+			_ = w.kernelDevice.Close()
+		}
 	})
 }
 
@@ -161,26 +227,182 @@ func (w *WireGuard) up() {
 	})
 }
 
-func (w *WireGuard) init() error {
-	host, port, _ := net.SplitHostPort(w.Base.Addr())
-	tryTimes := 0
+// resolveEndpoint resolves a WireGuard peer's "host:port" server address,
+// retrying DNS lookups the same way a single-peer outbound's endpoint does.
+func resolveEndpoint(addr string) (netip.AddrPort, error) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return netip.AddrPort{}, err
+	}
 
+	var (
+		endpointIP netip.Addr
+		tryTimes   int
+	)
 lookup:
-	endpointIP, err := resolver.ResolveProxyServerHost(host)
+	endpointIP, err = resolver.ResolveProxyServerHost(host)
 	if err != nil {
 		if tryTimes < 5 {
 			tryTimes++
 			time.Sleep(2 * time.Second)
 			goto lookup
 		}
-		return fmt.Errorf("parse server endpoint [%s] failure, cause: %w", w.Base.Addr(), err)
+		return netip.AddrPort{}, fmt.Errorf("parse server endpoint [%s] failure, cause: %w", addr, err)
 	}
 
 	p, _ := strconv.ParseUint(port, 10, 16)
-	endpoint := netip.AddrPortFrom(endpointIP, uint16(p))
-	w.uapiConf = append(w.uapiConf, fmt.Sprintf("endpoint=%s", endpoint))
+	return netip.AddrPortFrom(endpointIP, uint16(p)), nil
+}
 
-	wgBind := wireguard.NewWgBind(context.Background(), w.dialer, endpoint, w.reserved)
+// initKernel tries to stand up a kernel-mode WireGuard interface instead of
+// device.Device/gVisor, for near line-rate throughput on hosts that can
+// grant CAP_NET_ADMIN. It only supports the legacy single-peer shape today.
+// Traffic is routed into the interface the same way RoutingMark already
+// routes other outbounds' sockets: fwMark doubles as the dedicated routing
+// table id, and DialContext/ListenPacketContext mark their sockets with it.
+func (w *WireGuard) initKernel() error {
+	if len(w.peers) > 0 {
+		return errors.New("kernel-mode wireguard does not support multiple peers yet")
+	}
+	if w.fwMark == 0 {
+		return errors.New("kernel-mode wireguard requires routing-mark to route traffic into the interface")
+	}
+
+	endpoint, err := resolveEndpoint(w.Base.Addr())
+	if err != nil {
+		return err
+	}
+
+	allowedIPs := make([]netip.Prefix, 0, 2)
+	if w.localIP.IsValid() {
+		allowedIPs = append(allowedIPs, netip.PrefixFrom(netip.IPv4Unspecified(), 0))
+	}
+	if w.localIPv6.IsValid() {
+		allowedIPs = append(allowedIPs, netip.PrefixFrom(netip.IPv6Unspecified(), 0))
+	}
+
+	dev, err := kernel.New(kernel.Config{
+		Name:       kernelInterfaceName(w.threadId),
+		PrivateKey: w.privateKey,
+		FwMark:     w.fwMark,
+		Table:      w.fwMark,
+		Peers: []kernel.PeerConfig{{
+			PublicKey:                   w.publicKey,
+			PresharedKey:                w.presharedKey,
+			Endpoint:                    endpoint,
+			AllowedIPs:                  allowedIPs,
+			PersistentKeepaliveInterval: 25,
+		}},
+	})
+	if err != nil {
+		return err
+	}
+	w.kernelDevice = dev
+	return nil
+}
+
+// kernelInterfaceName derives a Linux interface name from threadId by
+// prefixing "wg-" and truncating to the 15-byte limit. Other characters of
+// the proxy name are kept as they are, and truncation can cut off
+// threadId's random suffix, so two proxies may map to the same name.
+func kernelInterfaceName(threadId string) string {
+	name := "wg-" + threadId
+	if len(name) > 15 {
+		name = name[:15]
+	}
+	return name
+}
+
+func (w *WireGuard) init() error {
+	if w.useKernel && kernel.Available() {
+		if err := w.initKernel(); err == nil {
+			return nil
+		} else {
+			log.Warn().Err(err).Msg("[WireGuard] kernel-mode setup failed, falling back to userspace")
+		}
+	}
+
+	// Roaming candidates only apply to the single-peer case: a multi-peer
+	// config picks its peer per destination via AllowedIPs routing instead,
+	// and roamGroup only ever tracks one peer's endpoint anyway.
+	var (
+		bindCandidates []netip.AddrPort
+		probeInterval  time.Duration
+		primaryEp      netip.AddrPort
+	)
+	if len(w.peers) == 0 {
+		var err error
+		primaryEp, err = resolveEndpoint(w.Base.Addr())
+		if err != nil {
+			return err
+		}
+		if len(w.candidates) > 0 {
+			bindCandidates = append(bindCandidates, primaryEp)
+			for _, candidate := range w.candidates {
+				alt, err := resolveEndpoint(candidate)
+				if err != nil {
+					return fmt.Errorf("resolve wireguard candidate endpoint failure, cause: %w", err)
+				}
+				bindCandidates = append(bindCandidates, alt)
+			}
+			probeInterval = time.Duration(w.probeInterval) * time.Second
+			if probeInterval <= 0 {
+				probeInterval = defaultRoamProbeInterval
+			}
+		}
+	}
+
+	wgBind := wireguard.NewWgBind(context.Background(), w.dialer, bindCandidates, probeInterval, wireguard.WgBindOptions{EnableGSO: w.gso, Parallel: w.parallel})
+
+	if len(w.peers) > 0 {
+		for _, peer := range w.peers {
+			endpoint, err := resolveEndpoint(net.JoinHostPort(peer.Server, strconv.Itoa(peer.Port)))
+			if err != nil {
+				return err
+			}
+
+			publicKeyBytes, err := base64.StdEncoding.DecodeString(peer.PublicKey)
+			if err != nil {
+				return fmt.Errorf("decode wireguard peer public key failure, cause: %w", err)
+			}
+			w.uapiConf = append(w.uapiConf, fmt.Sprintf("public_key=%s", hex.EncodeToString(publicKeyBytes)))
+
+			if peer.PreSharedKey != "" {
+				presharedKeyBytes, err := base64.StdEncoding.DecodeString(peer.PreSharedKey)
+				if err != nil {
+					return fmt.Errorf("decode wireguard peer preshared key failure, cause: %w", err)
+				}
+				w.uapiConf = append(w.uapiConf, fmt.Sprintf("preshared_key=%s", hex.EncodeToString(presharedKeyBytes)))
+			}
+
+			w.uapiConf = append(w.uapiConf, fmt.Sprintf("endpoint=%s", endpoint))
+
+			if len(peer.AllowedIPs) == 0 {
+				return fmt.Errorf("wireguard peer %s missing allowed-ips", peer.PublicKey)
+			}
+			for _, allowedIP := range peer.AllowedIPs {
+				w.uapiConf = append(w.uapiConf, fmt.Sprintf("allowed_ip=%s", allowedIP))
+			}
+
+			if peer.PersistentKeepalive > 0 {
+				w.uapiConf = append(w.uapiConf, fmt.Sprintf("persistent_keepalive_interval=%d", peer.PersistentKeepalive))
+			}
+
+			if peer.Reserved != "" {
+				reserved := strings.TrimPrefix(strings.ToLower(peer.Reserved), "0x")
+				reservedBytes, err := hex.DecodeString(reserved)
+				if err != nil || len(reservedBytes) != 3 {
+					return fmt.Errorf("decode wireguard peer reserved 3 bytes failure %w", err)
+				}
+				wgBind.SetReserved(wireguard.StdNetEndpoint(endpoint), reservedBytes)
+			}
+		}
+	} else {
+		w.uapiConf = append(w.uapiConf, fmt.Sprintf("endpoint=%s", primaryEp))
+		if w.reserved != nil {
+			wgBind.SetReserved(wireguard.StdNetEndpoint(primaryEp), w.reserved)
+		}
+	}
 
 	localIPs := make([]netip.Addr, 0, 2)
 	if w.localIP.IsValid() {
@@ -231,25 +453,42 @@ func NewWireGuard(option WireGuardOption) (*WireGuard, error) {
 	}
 	uapiConf = append(uapiConf, fmt.Sprintf("private_key=%s", hex.EncodeToString(privateKeyBytes)))
 
-	publicKeyBytes, err := base64.StdEncoding.DecodeString(option.PublicKey)
-	if err != nil {
-		return nil, fmt.Errorf("decode wireguard peer public key failure, cause: %w", err)
-	}
-	uapiConf = append(uapiConf, fmt.Sprintf("public_key=%s", hex.EncodeToString(publicKeyBytes)))
-
-	if option.PresharedKey != "" {
-		bytes, err := base64.StdEncoding.DecodeString(option.PresharedKey)
+	var reservedBytes []byte
+	if len(option.Peers) > 0 {
+		// Keys, allowed-ips and per-peer reserved bytes are validated and
+		// turned into UAPI config lines in init(), once each peer's
+		// endpoint has been resolved - the lines must stay grouped per
+		// peer, which a single upfront uapiConf slice can't express before
+		// resolution happens.
+		for _, peer := range option.Peers {
+			if _, err := base64.StdEncoding.DecodeString(peer.PublicKey); err != nil {
+				return nil, fmt.Errorf("decode wireguard peer public key failure, cause: %w", err)
+			}
+			if len(peer.AllowedIPs) == 0 {
+				return nil, fmt.Errorf("wireguard peer %s missing allowed-ips", peer.PublicKey)
+			}
+		}
+	} else {
+		publicKeyBytes, err := base64.StdEncoding.DecodeString(option.PublicKey)
 		if err != nil {
-			return nil, fmt.Errorf("decode wireguard preshared key failure, cause: %w", err)
+			return nil, fmt.Errorf("decode wireguard peer public key failure, cause: %w", err)
 		}
-		uapiConf = append(uapiConf, fmt.Sprintf("preshared_key=%s", hex.EncodeToString(bytes)))
-	}
+		uapiConf = append(uapiConf, fmt.Sprintf("public_key=%s", hex.EncodeToString(publicKeyBytes)))
 
-	var reservedBytes []byte
-	if option.Reserved != "" {
-		reserved := strings.TrimPrefix(strings.ToLower(option.Reserved), "0x")
-		if reservedBytes, err = hex.DecodeString(reserved); err != nil || len(reservedBytes) != 3 {
-			return nil, fmt.Errorf("decode wireguard reserved 3 bytes failure %w", err)
+		if option.PresharedKey != "" {
+			bytes, err := base64.StdEncoding.DecodeString(option.PresharedKey)
+			if err != nil {
+				return nil, fmt.Errorf("decode wireguard preshared key failure, cause: %w", err)
+			}
+			uapiConf = append(uapiConf, fmt.Sprintf("preshared_key=%s", hex.EncodeToString(bytes)))
+		}
+
+		if option.Reserved != "" {
+			reserved := strings.TrimPrefix(strings.ToLower(option.Reserved), "0x")
+			var err error
+			if reservedBytes, err = hex.DecodeString(reserved); err != nil || len(reservedBytes) != 3 {
+				return nil, fmt.Errorf("decode wireguard reserved 3 bytes failure %w", err)
+			}
 		}
 	}
 
@@ -288,11 +527,13 @@ func NewWireGuard(option WireGuardOption) (*WireGuard, error) {
 		}
 	}
 
-	if localIP.IsValid() {
-		uapiConf = append(uapiConf, "allowed_ip=0.0.0.0/0")
-	}
-	if localIPv6.IsValid() {
-		uapiConf = append(uapiConf, "allowed_ip=::/0")
+	if len(option.Peers) == 0 {
+		if localIP.IsValid() {
+			uapiConf = append(uapiConf, "allowed_ip=0.0.0.0/0")
+		}
+		if localIPv6.IsValid() {
+			uapiConf = append(uapiConf, "allowed_ip=::/0")
+		}
 	}
 
 	mtu := option.MTU
@@ -311,15 +552,25 @@ func NewWireGuard(option WireGuardOption) (*WireGuard, error) {
 		rmark: option.RoutingMark,
 	}
 	wireGuard := &WireGuard{
-		Base:       base,
-		dialer:     &wgDialer{options: base.DialOptions()},
-		localIP:    localIP,
-		localIPv6:  localIPv6,
-		dnsServers: dnsServers,
-		reserved:   reservedBytes,
-		uapiConf:   uapiConf,
-		threadId:   threadId,
-		mtu:        mtu,
+		Base:          base,
+		dialer:        &wgDialer{options: base.DialOptions()},
+		localIP:       localIP,
+		localIPv6:     localIPv6,
+		dnsServers:    dnsServers,
+		reserved:      reservedBytes,
+		peers:         option.Peers,
+		uapiConf:      uapiConf,
+		threadId:      threadId,
+		mtu:           mtu,
+		useKernel:     option.Kernel,
+		gso:           option.Gso,
+		parallel:      option.Parallel,
+		candidates:    option.Candidates,
+		probeInterval: option.ProbeInterval,
+		fwMark:        option.RoutingMark,
+		privateKey:    option.PrivateKey,
+		publicKey:     option.PublicKey,
+		presharedKey:  option.PresharedKey,
 
 		remoteDnsResolve: option.RemoteDnsResolve,
 	}
@@ -0,0 +1,212 @@
+package gvisor
+
+import (
+	"net/netip"
+	"sync"
+	"sync/atomic"
+
+	"github.com/Dreamacro/clash/adapter/inbound"
+)
+
+// defaultUdpFlowRingSize bounds how many packets a single flow's ring may
+// hold before it starts dropping its own oldest entry, and
+// defaultUdpBackpressureBytes bounds the combined size of every ring, so one
+// noisy flow can't starve the others out of the shared backlog.
+const (
+	defaultUdpFlowRingSize      = 32
+	defaultUdpBackpressureBytes = 4 << 20 // 4 MiB
+)
+
+// udpFlowKey identifies one UDP flow the same way HandleUDP already does.
+type udpFlowKey struct {
+	lAddrPort netip.AddrPort
+	rAddrPort netip.AddrPort
+}
+
+// queuedUDPPacket is one packet parked in a flow's ring. packet is kept
+// alongside adapter so an eviction can release it via packet.Drop(), the
+// same cleanup HandleUDP already did for a packet it dropped outright.
+type queuedUDPPacket struct {
+	packet  *packet
+	adapter *inbound.PacketAdapter
+	size    int
+}
+
+// udpFlowRing is a small fixed-capacity circular buffer of queuedUDPPacket.
+// It drops its own oldest entry on overflow rather than the newest, so a
+// burst only ever costs a flow its stalest packet instead of whatever just
+// arrived.
+type udpFlowRing struct {
+	buf   []queuedUDPPacket
+	head  int
+	count int
+}
+
+func newUdpFlowRing(capacity int) *udpFlowRing {
+	return &udpFlowRing{buf: make([]queuedUDPPacket, capacity)}
+}
+
+// push enqueues p, evicting and returning the ring's oldest entry if it was
+// already full.
+func (r *udpFlowRing) push(p queuedUDPPacket) (evicted queuedUDPPacket, didEvict bool) {
+	if r.count == len(r.buf) {
+		evicted, didEvict = r.pop()
+	}
+	idx := (r.head + r.count) % len(r.buf)
+	r.buf[idx] = p
+	r.count++
+	return evicted, didEvict
+}
+
+func (r *udpFlowRing) pop() (queuedUDPPacket, bool) {
+	if r.count == 0 {
+		return queuedUDPPacket{}, false
+	}
+	p := r.buf[r.head]
+	r.buf[r.head] = queuedUDPPacket{}
+	r.head = (r.head + 1) % len(r.buf)
+	r.count--
+	return p, true
+}
+
+// udpBackpressure absorbs bursts that would otherwise make HandleUDP drop
+// the newest packet of every flow once gh.udpIn fills up - bad for
+// loss-sensitive protocols like QUIC/TUIC. A packet that can't go straight
+// onto udpIn is parked in its flow's ring instead, and a dedicated goroutine
+// drains the rings as udpIn frees up, round-robining between flows so one
+// busy flow can't starve the others out of delivery.
+type udpBackpressure struct {
+	udpIn    chan<- *inbound.PacketAdapter
+	ringSize int
+	maxBytes int64
+
+	mu    sync.Mutex
+	rings map[udpFlowKey]*udpFlowRing
+	order []udpFlowKey // round-robin drain order
+
+	notEmpty chan struct{}
+
+	// droppedTotal and queuedBytes are this backlog's metrics; they're kept
+	// as plain counters rather than wired into a real metrics backend since
+	// this tree doesn't have a hub/route metrics pipeline to publish through
+	// yet. Stats() is the hook point for when one exists.
+	droppedTotal atomic.Uint64
+	queuedBytes  atomic.Int64
+}
+
+func newUdpBackpressure(udpIn chan<- *inbound.PacketAdapter, ringSize int, maxBytes int64) *udpBackpressure {
+	if ringSize <= 0 {
+		ringSize = defaultUdpFlowRingSize
+	}
+	if maxBytes <= 0 {
+		maxBytes = defaultUdpBackpressureBytes
+	}
+	bp := &udpBackpressure{
+		udpIn:    udpIn,
+		ringSize: ringSize,
+		maxBytes: maxBytes,
+		rings:    make(map[udpFlowKey]*udpFlowRing),
+		notEmpty: make(chan struct{}, 1),
+	}
+	go bp.drainLoop()
+	return bp
+}
+
+// enqueue parks p in key's ring; it's only called once a non-blocking send
+// on gh.udpIn has already failed.
+func (bp *udpBackpressure) enqueue(key udpFlowKey, p queuedUDPPacket) {
+	bp.mu.Lock()
+
+	ring, ok := bp.rings[key]
+	if !ok {
+		ring = newUdpFlowRing(bp.ringSize)
+		bp.rings[key] = ring
+		bp.order = append(bp.order, key)
+	}
+
+	evicted, didEvict := ring.push(p)
+	bp.queuedBytes.Add(int64(p.size))
+	if didEvict {
+		bp.queuedBytes.Add(-int64(evicted.size))
+		bp.droppedTotal.Add(1)
+	}
+
+	// The overall high-water mark guards against many distinct flows each
+	// staying under ringSize but still adding up to an unbounded backlog:
+	// once crossed, the flow that just grew gives back its own oldest entry
+	// too, same as a same-flow ring overflow would.
+	if !didEvict && bp.queuedBytes.Load() > bp.maxBytes {
+		if extra, ok := ring.pop(); ok {
+			bp.queuedBytes.Add(-int64(extra.size))
+			bp.droppedTotal.Add(1)
+			evicted, didEvict = extra, true
+		}
+	}
+
+	bp.mu.Unlock()
+
+	if didEvict {
+		evicted.packet.Drop()
+	}
+
+	select {
+	case bp.notEmpty <- struct{}{}:
+	default:
+	}
+}
+
+// drainLoop feeds gh.udpIn from the rings in round-robin order. The send
+// onto udpIn is allowed to block here, since it's this dedicated goroutine's
+// job to smooth a burst out over time rather than the caller's.
+func (bp *udpBackpressure) drainLoop() {
+	for range bp.notEmpty {
+		for {
+			p, ok := bp.dequeue()
+			if !ok {
+				break
+			}
+			bp.udpIn <- p.adapter
+			bp.queuedBytes.Add(-int64(p.size))
+		}
+	}
+}
+
+func (bp *udpBackpressure) dequeue() (queuedUDPPacket, bool) {
+	bp.mu.Lock()
+	defer bp.mu.Unlock()
+
+	for len(bp.order) > 0 {
+		key := bp.order[0]
+		ring := bp.rings[key]
+		p, ok := ring.pop()
+		if ring.count == 0 {
+			bp.order = bp.order[1:]
+			delete(bp.rings, key)
+		} else {
+			bp.order = append(bp.order[1:], key)
+		}
+		if ok {
+			return p, true
+		}
+	}
+	return queuedUDPPacket{}, false
+}
+
+// Stats reports the backlog's current counters: the total number of packets
+// dropped across all flows (no per-flow breakdown is kept) and the queued
+// bytes. It's exported, rather than wired into a hub/route metrics
+// endpoint directly, because this tree doesn't contain a hub/route package
+// to wire it into; whatever does expose Clash's metrics API can call this
+// once it exists.
+func (bp *udpBackpressure) Stats() (droppedTotal uint64, queuedBytes int64) {
+	return bp.droppedTotal.Load(), bp.queuedBytes.Load()
+}
+
+// BackpressureStats reports gh's UDP backpressure backlog counters, see
+// udpBackpressure.Stats.
+func (gh *gvHandler) BackpressureStats() (droppedTotal uint64, queuedBytes int64) {
+	if gh.udpBackpressure == nil {
+		return 0, 0
+	}
+	return gh.udpBackpressure.Stats()
+}
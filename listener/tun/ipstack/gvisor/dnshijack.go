@@ -0,0 +1,247 @@
+package gvisor
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/Dreamacro/clash/component/dialer"
+)
+
+// dnsHijackTimeout bounds a single round trip to an upstream resolver,
+// whatever transport it uses.
+const dnsHijackTimeout = 5 * time.Second
+
+// DnsHijackHandler answers a hijacked DNS query by forwarding its raw wire
+// message to an upstream resolver and returning the raw wire reply.
+// HandleTCP/HandleUDP only deal with this interface, so a hijacked query is
+// resolved the same way regardless of whether the configured upstream is
+// bare UDP/TCP, DoH, or DoT.
+type DnsHijackHandler interface {
+	Resolve(msg []byte) ([]byte, error)
+}
+
+// NewDnsHijackHandler builds a DnsHijackHandler from upstreams, URLs such as
+// "udp://1.1.1.1:53", "tls://8.8.8.8:853" or "https://cloudflare-dns.com/dns-query".
+// With more than one upstream, the returned handler round-robins between
+// them and falls through to the next one whenever the current pick fails.
+func NewDnsHijackHandler(upstreams []string) (DnsHijackHandler, error) {
+	if len(upstreams) == 0 {
+		return nil, fmt.Errorf("dns-hijack requires at least one upstream")
+	}
+
+	handlers := make([]DnsHijackHandler, 0, len(upstreams))
+	for _, raw := range upstreams {
+		h, err := newSingleDnsHijackHandler(raw)
+		if err != nil {
+			return nil, fmt.Errorf("parse dns-hijack upstream %s failure, cause: %w", raw, err)
+		}
+		handlers = append(handlers, h)
+	}
+
+	if len(handlers) == 1 {
+		return handlers[0], nil
+	}
+	return &roundRobinDnsHijackHandler{handlers: handlers}, nil
+}
+
+func newSingleDnsHijackHandler(raw string) (DnsHijackHandler, error) {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return nil, err
+	}
+
+	switch strings.ToLower(u.Scheme) {
+	case "udp":
+		return &udpDnsHijackHandler{addr: u.Host}, nil
+	case "tcp":
+		return &tcpDnsHijackHandler{addr: u.Host}, nil
+	case "tls":
+		return &dotDnsHijackHandler{addr: u.Host}, nil
+	case "https":
+		return &dohDnsHijackHandler{url: raw}, nil
+	default:
+		return nil, fmt.Errorf("unsupported dns-hijack scheme %q", u.Scheme)
+	}
+}
+
+// udpDnsHijackHandler forwards the query to addr as a single plain UDP
+// datagram, matching what D.RelayDnsPacket already did before dns-hijack
+// grew explicit per-upstream transports.
+type udpDnsHijackHandler struct {
+	addr string
+}
+
+func (h *udpDnsHijackHandler) Resolve(msg []byte) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dnsHijackTimeout)
+	defer cancel()
+
+	conn, err := dialer.DialContext(ctx, "udp", h.addr)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	if err = conn.SetDeadline(time.Now().Add(dnsHijackTimeout)); err != nil {
+		return nil, err
+	}
+	if _, err = conn.Write(msg); err != nil {
+		return nil, err
+	}
+
+	buf := make([]byte, 4096)
+	n, err := conn.Read(buf)
+	if err != nil {
+		return nil, err
+	}
+	return buf[:n], nil
+}
+
+// tcpDnsHijackHandler forwards the query over plain DNS-over-TCP's 2-byte
+// length-prefixed framing.
+type tcpDnsHijackHandler struct {
+	addr string
+}
+
+func (h *tcpDnsHijackHandler) Resolve(msg []byte) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dnsHijackTimeout)
+	defer cancel()
+
+	conn, err := dialer.DialContext(ctx, "tcp", h.addr)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	if err = conn.SetDeadline(time.Now().Add(dnsHijackTimeout)); err != nil {
+		return nil, err
+	}
+	return exchangeFramed(conn, msg)
+}
+
+// dotDnsHijackHandler is DNS-over-TLS: the same 2-byte length-prefixed
+// framing as tcpDnsHijackHandler, wrapped in a TLS connection.
+type dotDnsHijackHandler struct {
+	addr string
+}
+
+func (h *dotDnsHijackHandler) Resolve(msg []byte) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dnsHijackTimeout)
+	defer cancel()
+
+	host, _, err := net.SplitHostPort(h.addr)
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := dialer.DialContext(ctx, "tcp", h.addr)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	tlsConn := tls.Client(conn, &tls.Config{ServerName: host})
+	if err = tlsConn.HandshakeContext(ctx); err != nil {
+		return nil, err
+	}
+	if err = tlsConn.SetDeadline(time.Now().Add(dnsHijackTimeout)); err != nil {
+		return nil, err
+	}
+	return exchangeFramed(tlsConn, msg)
+}
+
+// exchangeFramed writes msg to conn length-prefixed and reads back one
+// length-prefixed reply, the framing DNS-over-TCP and DNS-over-TLS share.
+func exchangeFramed(conn net.Conn, msg []byte) ([]byte, error) {
+	var out bytes.Buffer
+	if err := binary.Write(&out, binary.BigEndian, uint16(len(msg))); err != nil {
+		return nil, err
+	}
+	out.Write(msg)
+	if _, err := conn.Write(out.Bytes()); err != nil {
+		return nil, err
+	}
+
+	var lengthBuf [2]byte
+	if _, err := io.ReadFull(conn, lengthBuf[:]); err != nil {
+		return nil, err
+	}
+	length := binary.BigEndian.Uint16(lengthBuf[:])
+
+	reply := make([]byte, length)
+	if _, err := io.ReadFull(conn, reply); err != nil {
+		return nil, err
+	}
+	return reply, nil
+}
+
+// dohDnsHijackHandler is DNS-over-HTTPS: the query is POSTed as
+// application/dns-message to url, through an http.Transport dialing via
+// component/dialer so it egresses through whatever outbound/proxy Clash has
+// selected, same as every other DoH usage in this codebase.
+type dohDnsHijackHandler struct {
+	url string
+}
+
+var dohTransport = &http.Transport{
+	DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+		return dialer.DialContext(ctx, network, addr)
+	},
+}
+
+func (h *dohDnsHijackHandler) Resolve(msg []byte) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dnsHijackTimeout)
+	defer cancel()
+
+	client := &http.Client{Timeout: dnsHijackTimeout, Transport: dohTransport}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, h.url, bytes.NewReader(msg))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/dns-message")
+	req.Header.Set("Accept", "application/dns-message")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("doh upstream %s returned status %s", h.url, resp.Status)
+	}
+	return io.ReadAll(resp.Body)
+}
+
+// roundRobinDnsHijackHandler cycles through its handlers on every query,
+// falling through to the next one whenever the current pick errors, so a
+// single unreachable upstream doesn't stall resolution.
+type roundRobinDnsHijackHandler struct {
+	handlers []DnsHijackHandler
+	next     atomic.Uint32
+}
+
+func (h *roundRobinDnsHijackHandler) Resolve(msg []byte) ([]byte, error) {
+	start := h.next.Add(1) - 1
+
+	var lastErr error
+	for i := 0; i < len(h.handlers); i++ {
+		idx := (int(start) + i) % len(h.handlers)
+		reply, err := h.handlers[idx].Resolve(msg)
+		if err == nil {
+			return reply, nil
+		}
+		lastErr = err
+	}
+	return nil, lastErr
+}
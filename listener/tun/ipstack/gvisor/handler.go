@@ -23,10 +23,46 @@ type gvHandler struct {
 	broadcast netip.Addr
 	dnsHijack []C.DNSUrl
 
+	// dnsHijacker resolves hijacked queries. It's nil unless the user
+	// configured dns-hijack upstreams, in which case newGvHandler's caller
+	// built it with NewDnsHijackHandler and passed it in; a nil handler falls back to D.RelayDnsPacket's
+	// default resolution.
+	dnsHijacker DnsHijackHandler
+
+	// udpBackpressure absorbs bursts HandleUDP can't push onto udpIn right
+	// away instead of dropping them; see backpressure.go.
+	udpBackpressure *udpBackpressure
+
 	tcpIn chan<- C.ConnContext
 	udpIn chan<- *inbound.PacketAdapter
 }
 
+// newGvHandler builds a gvHandler. dnsHijacker may be nil, in which case
+// hijacked queries are resolved with D.RelayDnsPacket's default behavior
+// instead of a configured udp/tcp/doh/dot upstream. udpRingSize and
+// udpMaxQueuedBytes configure the per-flow backpressure queue; either may be
+// left at 0 to use its default.
+func newGvHandler(gateway, broadcast netip.Addr, dnsHijack []C.DNSUrl, dnsHijacker DnsHijackHandler, udpRingSize int, udpMaxQueuedBytes int64, tcpIn chan<- C.ConnContext, udpIn chan<- *inbound.PacketAdapter) *gvHandler {
+	return &gvHandler{
+		gateway:         gateway,
+		broadcast:       broadcast,
+		dnsHijack:       dnsHijack,
+		dnsHijacker:     dnsHijacker,
+		udpBackpressure: newUdpBackpressure(udpIn, udpRingSize, udpMaxQueuedBytes),
+		tcpIn:           tcpIn,
+		udpIn:           udpIn,
+	}
+}
+
+// resolveHijackedDns answers a hijacked query, preferring the configured
+// dnsHijacker and otherwise falling back to D.RelayDnsPacket.
+func (gh *gvHandler) resolveHijackedDns(msg []byte) ([]byte, error) {
+	if gh.dnsHijacker != nil {
+		return gh.dnsHijacker.Resolve(msg)
+	}
+	return D.RelayDnsPacket(msg)
+}
+
 func (gh *gvHandler) HandleTCP(tunConn net.Conn) {
 	var (
 		lAddrPort netip.AddrPort
@@ -73,7 +109,7 @@ func (gh *gvHandler) HandleTCP(tunConn net.Conn) {
 				return
 			}
 
-			msg, err1 := D.RelayDnsPacket(buf.Bytes())
+			msg, err1 := gh.resolveHijackedDns(buf.Bytes())
 			if err1 != nil {
 				return
 			}
@@ -134,7 +170,7 @@ func (gh *gvHandler) HandleUDP(stack *stack.Stack, id stack.TransportEndpointID,
 
 			defer data.Release()
 
-			msg, err := D.RelayDnsPacket(data.AsSlice())
+			msg, err := gh.resolveHijackedDns(data.AsSlice())
 			if err != nil {
 				return
 			}
@@ -157,14 +193,31 @@ func (gh *gvHandler) HandleUDP(stack *stack.Stack, id stack.TransportEndpointID,
 		lAddr: lAddrPort,
 		data:  data,
 	}
+	pa := inbound.NewPacketBy(udpPkt, lAddrPort, rAddrPort, C.TUN)
 
 	select {
-	case gh.udpIn <- inbound.NewPacketBy(udpPkt, lAddrPort, rAddrPort, C.TUN):
+	case gh.udpIn <- pa:
 	default:
+		if gh.udpBackpressure == nil {
+			// newGvHandler always builds udpBackpressure, but a gvHandler
+			// constructed some other way wouldn't have one - drop the packet
+			// the way this queue-full path did before the backpressure ring
+			// existed, rather than risk a nil-pointer panic here.
+			log.Debug().
+				NetIPAddrPort("lAddrPort", lAddrPort).
+				NetIPAddrPort("rAddrPort", rAddrPort).
+				Msg("[gVisor] udp inbound queue full, dropping (no backpressure ring)")
+			udpPkt.Drop()
+			return
+		}
 		log.Debug().
 			NetIPAddrPort("lAddrPort", lAddrPort).
 			NetIPAddrPort("rAddrPort", rAddrPort).
-			Msg("[gVisor] drop udp packet, because inbound queue is full")
-		udpPkt.Drop()
+			Msg("[gVisor] udp inbound queue full, queuing on per-flow backpressure ring")
+		gh.udpBackpressure.enqueue(udpFlowKey{lAddrPort: lAddrPort, rAddrPort: rAddrPort}, queuedUDPPacket{
+			packet:  udpPkt,
+			adapter: pa,
+			size:    data.Size(),
+		})
 	}
 }
@@ -0,0 +1,87 @@
+package wireguard
+
+import (
+	"flag"
+	"fmt"
+	"io"
+
+	"github.com/Dreamacro/clash/adapter/inbound"
+	C "github.com/Dreamacro/clash/constant"
+)
+
+// RunCLI dispatches a `wg`-style CLI invocation: args[0] selects a
+// subcommand (genkey, pubkey, serve), the same vocabulary the real `wg`
+// tool uses. It's the actual call site GenerateKeyPair, PublicKeyFromPrivate
+// and New were written to back. This tree doesn't have a cmd/main.go yet to
+// invoke RunCLI with os.Args, so nothing calls it today either - but
+// whatever eventually adds that entry point only needs to forward its
+// arguments here instead of reimplementing subcommand parsing from scratch.
+//
+// On success, closer is non-nil only for "serve" (the caller owns stopping
+// the listener by calling closer.Close()); genkey/pubkey always return a
+// nil closer.
+func RunCLI(args []string, stdout io.Writer, tcpIn chan<- C.ConnContext, udpIn chan<- *inbound.PacketAdapter) (closer io.Closer, err error) {
+	if len(args) == 0 {
+		return nil, fmt.Errorf("wireguard: expected a subcommand (genkey, pubkey, serve)")
+	}
+
+	switch args[0] {
+	case "genkey":
+		return nil, runGenKey(stdout)
+	case "pubkey":
+		return nil, runPubKey(args[1:], stdout)
+	case "serve":
+		return runServe(args[1:], tcpIn, udpIn)
+	default:
+		return nil, fmt.Errorf("wireguard: unknown subcommand %q", args[0])
+	}
+}
+
+func runGenKey(stdout io.Writer) error {
+	priv, _, err := GenerateKeyPair()
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintln(stdout, priv)
+	return err
+}
+
+// runPubKey derives the public key for the private key passed as args[0],
+// mirroring `wg pubkey <key>`.
+func runPubKey(args []string, stdout io.Writer) error {
+	if len(args) == 0 {
+		return fmt.Errorf("wireguard: pubkey requires a private key argument")
+	}
+	pub, err := PublicKeyFromPrivate(args[0])
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintln(stdout, pub)
+	return err
+}
+
+// runServe starts a Listener from command-line flags rather than a parsed
+// YAML Option, for running a WireGuard inbound standalone without a full
+// Clash config.
+func runServe(args []string, tcpIn chan<- C.ConnContext, udpIn chan<- *inbound.PacketAdapter) (*Listener, error) {
+	fs := flag.NewFlagSet("wireguard serve", flag.ContinueOnError)
+	listen := fs.String("listen", ":51820", "address to listen on")
+	privateKey := fs.String("private-key", "", "base64 private key")
+	mtu := fs.Int("mtu", 0, "tunnel MTU (0 = default)")
+	iface := fs.String("interface", "", "bind egress to this interface name")
+	mark := fs.Int("fwmark", 0, "fwmark/SO_MARK to apply to the listener's sockets")
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+	if *privateKey == "" {
+		return nil, fmt.Errorf("wireguard: serve requires -private-key")
+	}
+
+	return New(Option{
+		Listen:      *listen,
+		PrivateKey:  *privateKey,
+		MTU:         *mtu,
+		Interface:   *iface,
+		RoutingMark: *mark,
+	}, tcpIn, udpIn)
+}
@@ -0,0 +1,115 @@
+package wireguard
+
+import (
+	"net"
+	"net/netip"
+
+	"gvisor.dev/gvisor/pkg/tcpip"
+	"gvisor.dev/gvisor/pkg/tcpip/adapters/gonet"
+	"gvisor.dev/gvisor/pkg/tcpip/stack"
+	"gvisor.dev/gvisor/pkg/tcpip/transport/tcp"
+	"gvisor.dev/gvisor/pkg/tcpip/transport/udp"
+	"gvisor.dev/gvisor/pkg/waiter"
+
+	"github.com/Dreamacro/clash/adapter/inbound"
+	C "github.com/Dreamacro/clash/constant"
+)
+
+// tcpForwarderBacklog mirrors the backlog wireguard-go's own netstack demo
+// uses for its TCP forwarder.
+const tcpForwarderBacklog = 2048
+
+// gateway registers catch-all TCP/UDP forwarders on a gVisor stack and
+// turns every accepted flow into a Clash inbound event, so WireGuard peers
+// are routed through the normal rule engine instead of being dialed
+// directly.
+type gateway struct {
+	tcpForwarder *tcp.Forwarder
+	udpForwarder *udp.Forwarder
+}
+
+func newGateway(s *stack.Stack, tcpIn chan<- C.ConnContext, udpIn chan<- *inbound.PacketAdapter) (*gateway, error) {
+	gw := &gateway{}
+
+	gw.tcpForwarder = tcp.NewForwarder(s, 0, tcpForwarderBacklog, func(fr *tcp.ForwarderRequest) {
+		var wq waiter.Queue
+		ep, err := fr.CreateEndpoint(&wq)
+		if err != nil {
+			fr.Complete(true)
+			return
+		}
+		fr.Complete(false)
+
+		id := fr.ID()
+		lAddrPort := addrPortFrom(id.RemoteAddress, id.RemotePort)
+		rAddrPort := addrPortFrom(id.LocalAddress, id.LocalPort)
+
+		conn := gonet.NewTCPConn(&wq, ep)
+		tcpIn <- inbound.NewSocketBy(conn, lAddrPort, rAddrPort, C.TUN)
+	})
+	s.SetTransportProtocolHandler(tcp.ProtocolNumber, gw.tcpForwarder.HandlePacket)
+
+	gw.udpForwarder = udp.NewForwarder(s, func(fr *udp.ForwarderRequest) {
+		var wq waiter.Queue
+		ep, err := fr.CreateEndpoint(&wq)
+		if err != nil {
+			return
+		}
+
+		id := fr.ID()
+		lAddrPort := addrPortFrom(id.RemoteAddress, id.RemotePort)
+		rAddrPort := addrPortFrom(id.LocalAddress, id.LocalPort)
+
+		conn := gonet.NewUDPConn(s, &wq, ep)
+		go relayGatewayUDP(conn, lAddrPort, rAddrPort, udpIn)
+	})
+	s.SetTransportProtocolHandler(udp.ProtocolNumber, gw.udpForwarder.HandlePacket)
+
+	return gw, nil
+}
+
+func (gw *gateway) Close() error { return nil }
+
+func addrPortFrom(addr tcpip.Address, port uint16) netip.AddrPort {
+	a, _ := netip.AddrFromSlice(addr.AsSlice())
+	return netip.AddrPortFrom(a.Unmap(), port)
+}
+
+// relayGatewayUDP reads datagrams off a per-flow UDP endpoint the forwarder
+// created for one peer-initiated flow and feeds each one into udpIn as its
+// own PacketAdapter, matching the one-packet-per-event shape the rest of
+// Clash's UDP inbounds use.
+func relayGatewayUDP(conn net.Conn, lAddrPort, rAddrPort netip.AddrPort, udpIn chan<- *inbound.PacketAdapter) {
+	defer conn.Close()
+	buf := make([]byte, 65535)
+	for {
+		n, err := conn.Read(buf)
+		if err != nil {
+			return
+		}
+		data := make([]byte, n)
+		copy(data, buf[:n])
+		udpIn <- inbound.NewPacketBy(&gatewayPacket{conn: conn, data: data}, lAddrPort, rAddrPort, C.TUN)
+	}
+}
+
+// gatewayPacket implements Clash's C.UDPPacket over a single already-read
+// gVisor UDP flow endpoint.
+type gatewayPacket struct {
+	conn net.Conn
+	data []byte
+}
+
+func (p *gatewayPacket) Data() []byte {
+	return p.data
+}
+
+func (p *gatewayPacket) WriteBack(b []byte, _ net.Addr) (int, error) {
+	return p.conn.Write(b)
+}
+
+func (p *gatewayPacket) Drop() {}
+
+func (p *gatewayPacket) LocalAddr() net.Addr {
+	return p.conn.LocalAddr()
+}
@@ -0,0 +1,48 @@
+package wireguard
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+
+	"golang.org/x/crypto/curve25519"
+)
+
+// GenerateKeyPair produces a Curve25519 private/public key pair encoded the
+// way WireGuard config files expect (base64), equivalent to running
+// `wg genkey` followed by `wg pubkey`. It's meant to back a `wg genkey`/
+// `wg pubkey` CLI subcommand.
+func GenerateKeyPair() (privateKey string, publicKey string, err error) {
+	var priv [32]byte
+	if _, err = rand.Read(priv[:]); err != nil {
+		return "", "", fmt.Errorf("generate wireguard private key failure, cause: %w", err)
+	}
+
+	// Clamp per the Curve25519/WireGuard key-generation convention.
+	priv[0] &= 248
+	priv[31] &= 127
+	priv[31] |= 64
+
+	pub, err := curve25519.X25519(priv[:], curve25519.Basepoint)
+	if err != nil {
+		return "", "", fmt.Errorf("derive wireguard public key failure, cause: %w", err)
+	}
+
+	return base64.StdEncoding.EncodeToString(priv[:]), base64.StdEncoding.EncodeToString(pub), nil
+}
+
+// PublicKeyFromPrivate is the `wg pubkey` half alone, for deriving a public
+// key from an existing base64-encoded private key.
+func PublicKeyFromPrivate(privateKey string) (string, error) {
+	priv, err := base64.StdEncoding.DecodeString(privateKey)
+	if err != nil || len(priv) != 32 {
+		return "", fmt.Errorf("decode wireguard private key failure, cause: %w", err)
+	}
+
+	pub, err := curve25519.X25519(priv, curve25519.Basepoint)
+	if err != nil {
+		return "", fmt.Errorf("derive wireguard public key failure, cause: %w", err)
+	}
+
+	return base64.StdEncoding.EncodeToString(pub), nil
+}
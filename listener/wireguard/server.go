@@ -0,0 +1,214 @@
+package wireguard
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"net/netip"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/phuslu/log"
+	"golang.zx2c4.com/wireguard/device"
+	"golang.zx2c4.com/wireguard/tun"
+
+	"github.com/Dreamacro/clash/adapter/inbound"
+	C "github.com/Dreamacro/clash/constant"
+	"github.com/Dreamacro/clash/transport/wireguard"
+)
+
+// PeerOption describes one WireGuard peer allowed to connect to the
+// listener, mirroring the key/allowed-ip conventions already used by
+// outbound.WireGuardOption.
+type PeerOption struct {
+	PublicKey    string   `proxy:"public-key"`
+	PreSharedKey string   `proxy:"preshared-key,omitempty"`
+	AllowedIPs   []string `proxy:"allowed-ips"`
+	// Endpoint pins this peer's address up front, the same way a site-to-site
+	// peer's address is known to both ends in a normal wg config - only
+	// peers with this set can use Reserved below, since StdNetBind applies
+	// reserved bytes per remote endpoint and has no way to learn one for a
+	// peer that dials in without ever being told where to send to it first.
+	Endpoint string `proxy:"endpoint,omitempty"`
+	Reserved string `proxy:"reserved,omitempty"`
+}
+
+// Option is the YAML configuration for a WireGuard inbound listener.
+type Option struct {
+	Listen     string       `proxy:"listen"`
+	PrivateKey string       `proxy:"private-key"`
+	MTU        int          `proxy:"mtu,omitempty"`
+	Peers      []PeerOption `proxy:"peers"`
+	// Interface pins the listener's sockets to a network interface the same
+	// way outbound.WireGuardOption's Interface does, via SO_BINDTODEVICE
+	// where the platform has it and a matching source IP otherwise.
+	Interface string `proxy:"interface-name,omitempty"`
+	// RoutingMark applies a fwmark/SO_MARK to the listener's sockets, the
+	// same policy-routing hook outbound.WireGuardOption.RoutingMark offers.
+	RoutingMark int `proxy:"routing-mark,omitempty"`
+}
+
+// Listener terminates WireGuard peers and feeds the decrypted TCP/UDP flows
+// into Clash's normal inbound pipeline, so they get routed through the rule
+// engine like any other inbound and forwarded out via a regular outbound.
+type Listener struct {
+	option    Option
+	wgDevice  *device.Device
+	tunDevice tun.Device
+	gw        *gateway
+
+	closeOnce sync.Once
+	closeErr  error
+}
+
+// New starts a WireGuard inbound listener. tcpIn/udpIn are the same channels
+// every other inbound (HTTP, SOCKS, TUN, ...) pushes onto.
+func New(option Option, tcpIn chan<- C.ConnContext, udpIn chan<- *inbound.PacketAdapter) (*Listener, error) {
+	_, portStr, err := net.SplitHostPort(option.Listen)
+	if err != nil {
+		return nil, fmt.Errorf("parse wireguard listen address failure, cause: %w", err)
+	}
+	port, err := strconv.ParseUint(portStr, 10, 16)
+	if err != nil {
+		return nil, fmt.Errorf("parse wireguard listen port failure, cause: %w", err)
+	}
+
+	uapiConf := make([]string, 0, 4+len(option.Peers)*4)
+
+	privateKeyBytes, err := base64.StdEncoding.DecodeString(option.PrivateKey)
+	if err != nil {
+		return nil, fmt.Errorf("decode wireguard private key failure, cause: %w", err)
+	}
+	uapiConf = append(uapiConf,
+		fmt.Sprintf("private_key=%s", hex.EncodeToString(privateKeyBytes)),
+		fmt.Sprintf("listen_port=%d", port),
+	)
+
+	type pinnedReserved struct {
+		endpoint netip.AddrPort
+		reserved []byte
+	}
+	var reservedByEndpoint []pinnedReserved
+
+	for _, peer := range option.Peers {
+		publicKeyBytes, err := base64.StdEncoding.DecodeString(peer.PublicKey)
+		if err != nil {
+			return nil, fmt.Errorf("decode wireguard peer public key failure, cause: %w", err)
+		}
+		uapiConf = append(uapiConf, fmt.Sprintf("public_key=%s", hex.EncodeToString(publicKeyBytes)))
+
+		if peer.PreSharedKey != "" {
+			presharedKeyBytes, err := base64.StdEncoding.DecodeString(peer.PreSharedKey)
+			if err != nil {
+				return nil, fmt.Errorf("decode wireguard peer preshared key failure, cause: %w", err)
+			}
+			uapiConf = append(uapiConf, fmt.Sprintf("preshared_key=%s", hex.EncodeToString(presharedKeyBytes)))
+		}
+
+		if peer.Endpoint != "" {
+			endpoint, err := resolvePeerEndpoint(peer.Endpoint)
+			if err != nil {
+				return nil, fmt.Errorf("resolve wireguard peer %s endpoint failure, cause: %w", peer.PublicKey, err)
+			}
+			uapiConf = append(uapiConf, fmt.Sprintf("endpoint=%s", endpoint))
+
+			if peer.Reserved != "" {
+				reserved := strings.TrimPrefix(strings.ToLower(peer.Reserved), "0x")
+				reservedBytes, err := hex.DecodeString(reserved)
+				if err != nil || len(reservedBytes) != 3 {
+					return nil, fmt.Errorf("decode wireguard peer reserved 3 bytes failure %w", err)
+				}
+				reservedByEndpoint = append(reservedByEndpoint, pinnedReserved{endpoint: endpoint, reserved: reservedBytes})
+			}
+		} else if peer.Reserved != "" {
+			return nil, fmt.Errorf("wireguard peer %s has reserved bytes but no endpoint - StdNetBind applies "+
+				"reserved bytes per remote endpoint and has no way to learn one for a peer that dials in without "+
+				"an endpoint pinned up front", peer.PublicKey)
+		}
+
+		if len(peer.AllowedIPs) == 0 {
+			return nil, fmt.Errorf("wireguard peer %s missing allowed-ips", peer.PublicKey)
+		}
+		for _, allowedIP := range peer.AllowedIPs {
+			uapiConf = append(uapiConf, fmt.Sprintf("allowed_ip=%s", allowedIP))
+		}
+	}
+
+	mtu := option.MTU
+	if mtu == 0 {
+		mtu = 1408
+	}
+
+	tunDevice, netStack, err := wireguard.CreateGatewayNetTUN(mtu)
+	if err != nil {
+		return nil, fmt.Errorf("create wireguard gateway tun failure, cause: %w", err)
+	}
+
+	logger := &device.Logger{
+		Verbosef: func(format string, args ...any) {
+			log.Debug().Msgf("[WireGuard] [server %s] "+strings.ToLower(format), append([]any{option.Listen}, args...)...)
+		},
+		Errorf: func(format string, args ...any) {
+			log.Error().Msgf("[WireGuard] [server %s] "+strings.ToLower(format), append([]any{option.Listen}, args...)...)
+		},
+	}
+
+	stdBind := wireguard.NewStdNetBind(nil, option.Interface, uint32(option.RoutingMark)).(*wireguard.StdNetBind)
+	for _, pinned := range reservedByEndpoint {
+		stdBind.SetReserved(pinned.endpoint, pinned.reserved)
+	}
+	wgDevice := device.NewDevice(tunDevice, stdBind, logger)
+
+	log.Debug().Strs("config", uapiConf).Msgf("[WireGuard] initial wireguard server listener on %s", option.Listen)
+
+	if err = wgDevice.IpcSet(strings.Join(uapiConf, "\n")); err != nil {
+		wgDevice.Close()
+		return nil, fmt.Errorf("apply wireguard server config failure, cause: %w", err)
+	}
+
+	gw, err := newGateway(netStack, tcpIn, udpIn)
+	if err != nil {
+		wgDevice.Close()
+		return nil, fmt.Errorf("create wireguard gateway failure, cause: %w", err)
+	}
+
+	l := &Listener{
+		option:    option,
+		wgDevice:  wgDevice,
+		tunDevice: tunDevice,
+		gw:        gw,
+	}
+	return l, nil
+}
+
+// resolvePeerEndpoint parses a PeerOption.Endpoint value, which may be a
+// literal "host:port" or a "hostname:port" needing a DNS lookup.
+func resolvePeerEndpoint(addr string) (netip.AddrPort, error) {
+	if ap, err := netip.ParseAddrPort(addr); err == nil {
+		return ap, nil
+	}
+	udpAddr, err := net.ResolveUDPAddr("udp", addr)
+	if err != nil {
+		return netip.AddrPort{}, err
+	}
+	ip, ok := netip.AddrFromSlice(udpAddr.IP)
+	if !ok {
+		return netip.AddrPort{}, fmt.Errorf("invalid endpoint address %s", addr)
+	}
+	return netip.AddrPortFrom(ip.Unmap(), uint16(udpAddr.Port)), nil
+}
+
+func (l *Listener) Close() error {
+	l.closeOnce.Do(func() {
+		l.gw.Close()
+		l.wgDevice.Close()
+		l.closeErr = l.tunDevice.Close()
+	})
+	return l.closeErr
+}
+
+func (l *Listener) Address() string {
+	return l.option.Listen
+}
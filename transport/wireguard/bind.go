@@ -2,135 +2,315 @@ package wireguard
 
 import (
 	"context"
+	"encoding/binary"
 	"errors"
 	"net"
 	"net/netip"
+	"runtime"
 	"sync"
+	"sync/atomic"
 	"syscall"
 	"time"
 
+	"golang.org/x/net/ipv4"
+	"golang.org/x/net/ipv6"
 	"golang.zx2c4.com/wireguard/conn"
 )
 
+// wgMaxPacketSize is a safe upper bound for a single WireGuard datagram
+// (transport MTU plus protocol overhead); it only sizes the per-connection
+// read buffer, it isn't enforced on the wire.
+const wgMaxPacketSize = 2048
+
 type wgDialer interface {
 	DialContext(context.Context, string, netip.AddrPort) (net.Conn, error)
 }
 
 var _ conn.Bind = (*WgBind)(nil)
 
+// WgBind is a conn.Bind that dials out through Clash's own dialer instead of
+// a raw socket. Unlike StdNetBind it doesn't listen for unsolicited traffic;
+// it lazily dials a pool of connections (one by default, see
+// WgBindOptions.Parallel) per distinct endpoint it's asked to send to, which lets a single device.Device talk to several WireGuard peers
+// (each with their own endpoint) at once, with device.Device picking the
+// right peer/endpoint per packet via its own AllowedIPs routing.
 type WgBind struct {
-	ctx      context.Context
-	dialer   wgDialer
-	endpoint StdNetEndpoint
-	reserved []byte
-	conn     *wgConn
-	connMux  sync.Mutex
-	done     chan struct{}
-}
-
-func (wb *WgBind) connect() (*wgConn, error) {
-	serverConn := wb.conn
-	if serverConn != nil {
-		select {
-		case <-serverConn.done:
-			serverConn = nil
-		default:
-			return serverConn, nil
+	ctx    context.Context
+	dialer wgDialer
+	opts   WgBindOptions
+
+	mu       sync.Mutex
+	conns    map[StdNetEndpoint]*wgConnPool
+	reserved map[StdNetEndpoint][]byte
+
+	// roam tracks RTT/failure stats across candidates and picks the one
+	// connectPool() should dial next; it's nil unless NewWgBind was given more
+	// than one candidate address. roamEp is the endpoint key device.Device
+	// itself knows about (the first candidate), since Bind doesn't get to
+	// change what key the device looks endpoints up by.
+	roam   *roamGroup
+	roamEp StdNetEndpoint
+
+	recv chan wgRecvResult
+	done chan struct{}
+}
+
+// WgBindOptions configures optional fast paths for WgBind.
+type WgBindOptions struct {
+	// EnableGSO opts a wgConn into coalescing equal-sized outgoing packets
+	// into a single UDP_SEGMENT sendmsg on Linux - the same offload
+	// StdNetBind already uses, see gso_linux.go. It's off by default since
+	// not every kernel/NIC combination supports it; wgConn falls back to
+	// its normal write path the first time the kernel rejects the cmsg.
+	EnableGSO bool
+
+	// Parallel is how many wgConns connectPool() dials per distinct endpoint,
+	// each getting its own kernel socket (and thus its own receive buffer
+	// and source port). Defaults to 1, preserving the original single-socket
+	// behavior; raising it lets multi-core hosts push more throughput to a
+	// single peer, since one UDP socket's receive buffer is otherwise a hard
+	// ceiling regardless of CPU available to device.Device.
+	Parallel int
+}
+
+type wgRecvResult struct {
+	b  []byte
+	ep StdNetEndpoint
+}
+
+// NewWgBind builds a WgBind. When candidates holds more than one address,
+// the first is the endpoint key the caller must configure the peer with
+// (e.g. the UAPI endpoint= line); WgBind then probes the rest in the
+// background and transparently redials through whichever one currently
+// looks healthiest. probeInterval is both the health-check cadence and how
+// long a candidate may stay silent before it's considered degraded; it's
+// ignored when candidates has fewer than two entries.
+func NewWgBind(ctx context.Context, dialer wgDialer, candidates []netip.AddrPort, probeInterval time.Duration, opts WgBindOptions) *WgBind {
+	wb := &WgBind{
+		ctx:      ctx,
+		dialer:   dialer,
+		opts:     opts,
+		conns:    make(map[StdNetEndpoint]*wgConnPool),
+		reserved: make(map[StdNetEndpoint][]byte),
+		recv:     make(chan wgRecvResult, 256),
+		done:     make(chan struct{}),
+	}
+	if len(candidates) > 1 {
+		wb.roam = newRoamGroup(candidates)
+		wb.roamEp = StdNetEndpoint(candidates[0])
+		if probeInterval > 0 {
+			go wb.probeLoop(probeInterval)
 		}
 	}
+	return wb
+}
 
-	wb.connMux.Lock()
-	defer wb.connMux.Unlock()
+// SetReserved records the 3 reserved header bytes to rewrite on outgoing
+// packets bound for ep (used by some providers, e.g. Cloudflare WARP, to
+// obfuscate the WireGuard header). Each peer/endpoint can carry its own.
+func (wb *WgBind) SetReserved(ep StdNetEndpoint, reserved []byte) {
+	wb.mu.Lock()
+	defer wb.mu.Unlock()
+	wb.reserved[ep] = reserved
+}
 
-	serverConn = wb.conn
-	if serverConn != nil {
-		select {
-		case <-serverConn.done:
-			serverConn = nil
-		default:
-			return serverConn, nil
-		}
+// parallelism is how many wgConns connectPool dials per distinct endpoint.
+func (wb *WgBind) parallelism() int {
+	if wb.opts.Parallel > 0 {
+		return wb.opts.Parallel
 	}
+	return 1
+}
 
-	udpConn, err := wb.dialer.DialContext(wb.ctx, "udp", (netip.AddrPort)(wb.endpoint))
-	if err != nil {
-		return nil, &wgError{err}
+func (wb *WgBind) connectPool(ep StdNetEndpoint) (*wgConnPool, error) {
+	wb.mu.Lock()
+	if p, ok := wb.conns[ep]; ok {
+		wb.mu.Unlock()
+		wb.healPool(ep, p)
+		return p, nil
 	}
-	wb.conn = &wgConn{
-		Conn: udpConn,
-		done: make(chan struct{}),
+	wb.mu.Unlock()
+
+	dialTarget := (netip.AddrPort)(ep)
+	if wb.roam != nil && ep == wb.roamEp {
+		dialTarget = wb.roam.currentTarget()
 	}
-	return wb.conn, nil
-}
 
-func (wb *WgBind) Open(_ uint16) (fns []conn.ReceiveFunc, actualPort uint16, err error) {
+	n := wb.parallelism()
+	p := &wgConnPool{conns: make([]*wgConn, 0, n)}
+	for i := 0; i < n; i++ {
+		c, err := wb.dial(dialTarget)
+		if err != nil {
+			for _, existing := range p.conns {
+				_ = existing.Close()
+			}
+			return nil, err
+		}
+		p.conns = append(p.conns, c)
+	}
+
+	wb.mu.Lock()
 	select {
 	case <-wb.done:
-		err = net.ErrClosed
-		return
+		wb.mu.Unlock()
+		for _, c := range p.conns {
+			_ = c.Close()
+		}
+		return nil, net.ErrClosed
 	default:
 	}
-	return []conn.ReceiveFunc{wb.receive}, 0, nil
+	wb.conns[ep] = p
+	wb.mu.Unlock()
+
+	for _, c := range p.conns {
+		go wb.readLoop(ep, c)
+	}
+	return p, nil
 }
 
-func (wb *WgBind) receive(packets [][]byte, sizes []int, eps []conn.Endpoint) (n int, err error) {
-	var udpConn *wgConn
-	udpConn, err = wb.connect()
+// dial opens one socket to dialTarget and wraps it for batching, same as a
+// single-socket connect used to before connectPool pooled several of these
+// per endpoint.
+func (wb *WgBind) dial(dialTarget netip.AddrPort) (*wgConn, error) {
+	udpConn, err := wb.dialer.DialContext(wb.ctx, "udp", dialTarget)
 	if err != nil {
+		return nil, &wgError{err}
+	}
+	c := &wgConn{Conn: udpConn, done: make(chan struct{}), remote: dialTarget}
+	c.touch()
+
+	// Wrap the dialed conn in an ipv{4,6}.PacketConn when it's a real
+	// *net.UDPConn, so Send/readLoop can batch several datagrams into one
+	// ReadBatch/WriteBatch syscall instead of one syscall per packet.
+	// ReadBatch/WriteBatch are only implemented on Linux; elsewhere both
+	// stay nil and wgConn falls back to its plain Read/Write loop.
+	if runtime.GOOS == "linux" {
+		if uc, ok := udpConn.(*net.UDPConn); ok {
+			c.udpConn = uc
+			c.gso.Store(wb.opts.EnableGSO)
+			if dialTarget.Addr().Is6() {
+				c.pc6 = ipv6.NewPacketConn(uc)
+			} else {
+				c.pc4 = ipv4.NewPacketConn(uc)
+			}
+		}
+	}
+	return c, nil
+}
+
+// healPool redials any member of p whose socket has already died (e.g. a
+// read error closed it), replacing it in place so one failed socket doesn't
+// take the rest of the pool down with it.
+func (wb *WgBind) healPool(ep StdNetEndpoint, p *wgConnPool) {
+	dialTarget := (netip.AddrPort)(ep)
+	if wb.roam != nil && ep == wb.roamEp {
+		dialTarget = wb.roam.currentTarget()
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for i, c := range p.conns {
 		select {
-		case <-wb.done:
-			err = net.ErrClosed
+		case <-c.done:
 		default:
-			err = nil
+			continue
 		}
-		if wgErr, ok := err.(*wgError); ok && wgErr.IsError(syscall.ENETUNREACH) {
-			time.Sleep(2 * time.Second)
+		nc, err := wb.dial(dialTarget)
+		if err != nil {
+			continue
 		}
-		return
+		p.conns[i] = nc
+		go wb.readLoop(ep, nc)
+	}
+}
+
+func (wb *WgBind) readLoop(ep StdNetEndpoint, c *wgConn) {
+	batchSize := wb.BatchSize()
+	bufs := make([][]byte, batchSize)
+	sizes := make([]int, batchSize)
+	for i := range bufs {
+		bufs[i] = make([]byte, wgMaxPacketSize)
 	}
 
-	for i, b := range packets {
-		var size int
-		size, err = udpConn.Read(b)
-		sizes[i] = size
-		n = i
+	for {
+		n, err := c.readBatch(bufs, sizes)
 		if err != nil {
-			_ = udpConn.Close()
+			_ = c.Close()
+			return
+		}
+		c.touch()
+		if wb.roam != nil && ep == wb.roamEp {
+			wb.roam.markSeen(c.remote, c.roundTrip())
+		}
+		for i := 0; i < n; i++ {
+			b := make([]byte, sizes[i])
+			copy(b, bufs[i][:sizes[i]])
 			select {
+			case wb.recv <- wgRecvResult{b: b, ep: ep}:
 			case <-wb.done:
-				err = net.ErrClosed
 				return
-			default:
-				sizes[i] = 0
-				err = nil
 			}
-			return
 		}
-		wb.resetReserved(b)
-		eps[i] = wb.endpoint
 	}
-	n = len(packets)
-	return
+}
+
+func (wb *WgBind) Open(_ uint16) (fns []conn.ReceiveFunc, actualPort uint16, err error) {
+	select {
+	case <-wb.done:
+		err = net.ErrClosed
+		return
+	default:
+	}
+	return []conn.ReceiveFunc{wb.receive}, 0, nil
+}
+
+func (wb *WgBind) receive(packets [][]byte, sizes []int, eps []conn.Endpoint) (n int, err error) {
+	select {
+	case <-wb.done:
+		return 0, net.ErrClosed
+	case res := <-wb.recv:
+		sizes[0] = copy(packets[0], res.b)
+		wb.resetReserved(packets[0])
+		eps[0] = res.ep
+		n = 1
+	}
+
+	// Opportunistically drain whatever's already queued, up to the caller's
+	// batch, instead of returning after a single packet - this is what lets
+	// a batched readLoop actually translate into fewer device.Device calls.
+	for n < len(packets) {
+		select {
+		case res := <-wb.recv:
+			sizes[n] = copy(packets[n], res.b)
+			wb.resetReserved(packets[n])
+			eps[n] = res.ep
+			n++
+		default:
+			return n, nil
+		}
+	}
+	return n, nil
 }
 
 func (wb *WgBind) Reset() {
-	wb.connMux.Lock()
-	defer wb.connMux.Unlock()
-	if wb.conn != nil {
-		_ = wb.conn.Close()
+	wb.mu.Lock()
+	conns := wb.conns
+	wb.conns = make(map[StdNetEndpoint]*wgConnPool)
+	wb.mu.Unlock()
+	for _, p := range conns {
+		p.close()
 	}
 }
 
 func (wb *WgBind) Close() error {
-	wb.connMux.Lock()
-	defer wb.connMux.Unlock()
-	if wb.conn != nil {
-		_ = wb.conn.Close()
-	}
-	if wb.done == nil {
-		wb.done = make(chan struct{})
-		return nil
+	wb.mu.Lock()
+	conns := wb.conns
+	wb.conns = make(map[StdNetEndpoint]*wgConnPool)
+	wb.mu.Unlock()
+	for _, p := range conns {
+		p.close()
 	}
+
 	select {
 	case <-wb.done:
 		return net.ErrClosed
@@ -144,41 +324,173 @@ func (wb *WgBind) SetMark(_ uint32) error {
 	return nil
 }
 
+// BatchSize reports conn.IdealBatchSize on Linux, where dial wraps dialed
+// *net.UDPConns in an ipv{4,6}.PacketConn capable of ReadBatch/WriteBatch;
+// elsewhere wgConn only has a plain Read/Write loop to offer, so batching
+// wouldn't save any syscalls.
 func (wb *WgBind) BatchSize() int {
+	if runtime.GOOS == "linux" {
+		return conn.IdealBatchSize
+	}
 	return 1
 }
 
-func (wb *WgBind) Send(buffs [][]byte, _ conn.Endpoint) error {
-	udpConn, err := wb.connect()
+func (wb *WgBind) Send(buffs [][]byte, endpoint conn.Endpoint) error {
+	ep, ok := endpoint.(StdNetEndpoint)
+	if !ok {
+		return &wgError{errors.New("wgbind: unsupported endpoint type")}
+	}
+
+	pool, err := wb.connectPool(ep)
 	if err != nil {
+		select {
+		case <-wb.done:
+			return net.ErrClosed
+		default:
+		}
+		if wgErr, ok := err.(*wgError); ok && wgErr.IsError(syscall.ENETUNREACH) {
+			time.Sleep(2 * time.Second)
+		}
 		return err
 	}
+
+	reserved := wb.reservedFor(ep)
+	for _, b := range buffs {
+		setReservedBytes(b, reserved)
+	}
+
+	// Route each packet to one of the pool's sockets, keyed by its receiver
+	// index (for transport data messages) or a round-robin counter
+	// otherwise, then batch together whatever lands on the same socket.
+	groups := make(map[*wgConn][][]byte, len(pool.conns))
+	order := make([]*wgConn, 0, len(pool.conns))
 	for _, b := range buffs {
-		wb.setReserved(b)
-		_, err = udpConn.Write(b)
-		if err != nil {
-			_ = udpConn.Close()
+		c := pool.pickConn(b)
+		if _, ok = groups[c]; !ok {
+			order = append(order, c)
+		}
+		groups[c] = append(groups[c], b)
+	}
+
+	for _, c := range order {
+		if err = c.writeBatch(groups[c]); err != nil {
+			_ = c.Close()
 			return err
 		}
+		c.touch()
+		c.markSent()
 	}
 	return nil
 }
 
-func (wb *WgBind) ParseEndpoint(_ string) (conn.Endpoint, error) {
-	return wb.endpoint, nil
+// roamProbeTimeout bounds how long probeOne waits for a candidate's network
+// path to accept a write before giving up on it.
+const roamProbeTimeout = 2 * time.Second
+
+// probeLoop watches the roaming endpoint's active candidate and fails over
+// to the next-healthiest one once it's gone quiet for a full probeInterval,
+// and actively probes every other candidate on the same cadence so degrade
+// has fresher reachability/RTT data to pick from than whatever's left over
+// from the last time that candidate was active.
+func (wb *WgBind) probeLoop(probeInterval time.Duration) {
+	ticker := time.NewTicker(probeInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-wb.done:
+			return
+		case <-ticker.C:
+			wb.probeCandidates()
+			wb.checkRoamHealth(probeInterval)
+		}
+	}
 }
 
-func (wb *WgBind) Endpoint() conn.Endpoint {
-	return wb.endpoint
+// probeCandidates actively probes every candidate other than the one
+// currently active. A real WireGuard handshake round trip isn't available
+// here - only device.Device holds the session keys needed to build one -
+// so this is a STUN-style "does anything answer a UDP write to this
+// address" reachability check, same spirit as a keepalive probe even though
+// it can't observe the peer's actual handshake response.
+func (wb *WgBind) probeCandidates() {
+	if wb.roam == nil {
+		return
+	}
+	active := wb.roam.currentTarget()
+	for _, candidate := range wb.roam.allCandidates() {
+		if candidate == active {
+			continue
+		}
+		go wb.probeOne(candidate)
+	}
 }
 
-func (wb *WgBind) setReserved(b []byte) {
-	if len(b) < 4 || wb.reserved == nil {
+func (wb *WgBind) probeOne(addr netip.AddrPort) {
+	start := time.Now()
+	c, err := wb.dialer.DialContext(wb.ctx, "udp", addr)
+	if err != nil {
+		wb.roam.markProbed(addr, false, 0)
 		return
 	}
-	b[1] = wb.reserved[0]
-	b[2] = wb.reserved[1]
-	b[3] = wb.reserved[2]
+	defer func() { _ = c.Close() }()
+
+	if err = c.SetWriteDeadline(start.Add(roamProbeTimeout)); err != nil {
+		wb.roam.markProbed(addr, false, 0)
+		return
+	}
+	if _, err = c.Write([]byte{0}); err != nil {
+		wb.roam.markProbed(addr, false, 0)
+		return
+	}
+	wb.roam.markProbed(addr, true, time.Since(start))
+}
+
+func (wb *WgBind) checkRoamHealth(probeInterval time.Duration) {
+	wb.mu.Lock()
+	p, ok := wb.conns[wb.roamEp]
+	wb.mu.Unlock()
+	if !ok || time.Since(p.lastActiveTime()) < probeInterval {
+		return
+	}
+
+	if _, _, switched := wb.roam.degrade(); !switched {
+		return
+	}
+
+	// Drop the stale pool so the next Send redials through connectPool,
+	// which will pick up the roamGroup's newly active candidate.
+	wb.mu.Lock()
+	delete(wb.conns, wb.roamEp)
+	wb.mu.Unlock()
+	p.close()
+}
+
+// ParseEndpoint parses s (e.g. a UAPI endpoint= line) into the Endpoint
+// device.Device will keep passing to Send. When WgBind is roaming, s is
+// expected to be candidates[0] from NewWgBind - Send/connectPool already
+// redirect traffic to whichever candidate currently looks healthiest, so
+// the device doesn't need to know the active address changed underneath it.
+func (*WgBind) ParseEndpoint(s string) (conn.Endpoint, error) {
+	e, err := netip.ParseAddrPort(s)
+	if err != nil {
+		return nil, err
+	}
+	return StdNetEndpoint(e), nil
+}
+
+func (wb *WgBind) reservedFor(ep StdNetEndpoint) []byte {
+	wb.mu.Lock()
+	defer wb.mu.Unlock()
+	return wb.reserved[ep]
+}
+
+func setReservedBytes(b []byte, reserved []byte) {
+	if len(b) < 4 || reserved == nil {
+		return
+	}
+	b[1] = reserved[0]
+	b[2] = reserved[1]
+	b[3] = reserved[2]
 }
 
 func (wb *WgBind) resetReserved(b []byte) {
@@ -190,19 +502,235 @@ func (wb *WgBind) resetReserved(b []byte) {
 	b[3] = 0x00
 }
 
-func NewWgBind(ctx context.Context, dialer wgDialer, endpoint netip.AddrPort, reserved []byte) *WgBind {
-	return &WgBind{
-		ctx:      ctx,
-		dialer:   dialer,
-		reserved: reserved,
-		endpoint: StdNetEndpoint(endpoint),
+// wgConnPool is every wgConn dialed for one endpoint. With WgBindOptions.
+// Parallel at its default of 1 this always holds a single conn, behaving
+// exactly like the original one-socket-per-endpoint design; raising it
+// spreads a peer's traffic across several kernel sockets instead.
+type wgConnPool struct {
+	mu    sync.Mutex
+	conns []*wgConn
+	next  atomic.Uint32
+}
+
+// pickConn chooses which socket should carry buf. Transport data messages
+// carry a receiver_index at bytes 4:8 that identifies the session, so
+// packets belonging to the same session keep going out the same socket;
+// anything else (handshake messages, or a buffer too short to hold an
+// index) round-robins instead.
+func (p *wgConnPool) pickConn(buf []byte) *wgConn {
+	p.mu.Lock()
+	conns := p.conns
+	p.mu.Unlock()
+
+	if len(conns) == 1 {
+		return conns[0]
+	}
+
+	var idx uint32
+	if len(buf) >= 8 && buf[0] == 4 { // 4 = transport data message type
+		idx = binary.LittleEndian.Uint32(buf[4:8])
+	} else {
+		idx = p.next.Add(1)
+	}
+	return conns[idx%uint32(len(conns))]
+}
+
+func (p *wgConnPool) snapshot() []*wgConn {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	out := make([]*wgConn, len(p.conns))
+	copy(out, p.conns)
+	return out
+}
+
+func (p *wgConnPool) close() {
+	for _, c := range p.snapshot() {
+		_ = c.Close()
+	}
+}
+
+// lastActiveTime reports the most recent activity across every socket in
+// the pool, since WgBind's roaming health check cares whether the endpoint
+// as a whole has gone quiet, not any one particular socket within it.
+func (p *wgConnPool) lastActiveTime() time.Time {
+	var latest time.Time
+	for _, c := range p.snapshot() {
+		if t := c.lastActiveTime(); t.After(latest) {
+			latest = t
+		}
 	}
+	return latest
 }
 
 type wgConn struct {
 	net.Conn
 	access sync.Mutex
 	done   chan struct{}
+
+	// pc4/pc6 are non-nil only on Linux, and only when Conn is a real
+	// *net.UDPConn, letting readBatch/writeBatch use ReadBatch/WriteBatch
+	// instead of falling back to Conn's plain Read/Write.
+	pc4 *ipv4.PacketConn
+	pc6 *ipv6.PacketConn
+
+	// udpConn is the same underlying conn as pc4/pc6, kept as a *net.UDPConn
+	// so writeBatch can reach WriteMsgUDP directly for the GSO fast path.
+	// gso tracks whether UDP_SEGMENT still looks usable on it; it starts at
+	// WgBindOptions.EnableGSO and latches false the first time the kernel
+	// rejects the cmsg outright.
+	udpConn *net.UDPConn
+	gso     atomic.Bool
+
+	// remote is the address this conn is actually dialed to (the roamGroup's
+	// active candidate, when roaming). lastActive is the Unix-nano time of
+	// the most recent successful read or write, used by WgBind's roaming
+	// watchdog to detect a candidate that's gone quiet. lastSent is the
+	// Unix-nano time of the most recent successful write, used to turn the
+	// next read into a rough round-trip estimate for roamGroup.
+	remote     netip.AddrPort
+	lastActive atomic.Int64
+	lastSent   atomic.Int64
+}
+
+func (w *wgConn) touch() {
+	w.lastActive.Store(time.Now().UnixNano())
+}
+
+func (w *wgConn) markSent() {
+	w.lastSent.Store(time.Now().UnixNano())
+}
+
+// roundTrip estimates the time between the last packet this conn sent and
+// now, i.e. the time a just-received reply took - a stand-in for real
+// WireGuard handshake RTT, since Bind only sees encrypted opaque datagrams
+// and has no way to tell a handshake response from any other reply. Returns
+// 0 if nothing has been sent yet.
+func (w *wgConn) roundTrip() time.Duration {
+	ns := w.lastSent.Load()
+	if ns == 0 {
+		return 0
+	}
+	return time.Since(time.Unix(0, ns))
+}
+
+func (w *wgConn) lastActiveTime() time.Time {
+	ns := w.lastActive.Load()
+	if ns == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, ns)
+}
+
+// readBatch fills bufs with up to len(bufs) datagrams in as few syscalls as
+// possible, recording each one's length in sizes, and returns how many it
+// read.
+func (w *wgConn) readBatch(bufs [][]byte, sizes []int) (int, error) {
+	switch {
+	case w.pc4 != nil:
+		msgs := make([]ipv4.Message, len(bufs))
+		for i := range msgs {
+			msgs[i].Buffers = net.Buffers{bufs[i]}
+		}
+		n, err := w.pc4.ReadBatch(msgs, 0)
+		if err != nil {
+			return 0, err
+		}
+		for i := 0; i < n; i++ {
+			sizes[i] = msgs[i].N
+		}
+		return n, nil
+	case w.pc6 != nil:
+		msgs := make([]ipv6.Message, len(bufs))
+		for i := range msgs {
+			msgs[i].Buffers = net.Buffers{bufs[i]}
+		}
+		n, err := w.pc6.ReadBatch(msgs, 0)
+		if err != nil {
+			return 0, err
+		}
+		for i := 0; i < n; i++ {
+			sizes[i] = msgs[i].N
+		}
+		return n, nil
+	default:
+		n, err := w.Read(bufs[0])
+		if err != nil {
+			return 0, err
+		}
+		sizes[0] = n
+		return 1, nil
+	}
+}
+
+// writeBatch writes bufs out in as few syscalls as possible, preferring the
+// GSO fast path (a single sendmsg for the whole batch) over WriteBatch
+// (sendmmsg) over the plain per-packet loop.
+func (w *wgConn) writeBatch(bufs [][]byte) error {
+	if w.udpConn != nil && w.gso.Load() {
+		if segSize, ok := eligibleForGSO(bufs); ok {
+			if err := w.sendGSO(bufs, segSize); err == nil {
+				return nil
+			} else if isGSOFatal(err) {
+				w.gso.Store(false)
+			} else {
+				return err
+			}
+		}
+	}
+
+	switch {
+	case w.pc4 != nil:
+		msgs := make([]ipv4.Message, len(bufs))
+		for i, b := range bufs {
+			msgs[i].Buffers = net.Buffers{b}
+		}
+		for start := 0; start < len(msgs); {
+			n, err := w.pc4.WriteBatch(msgs[start:], 0)
+			if err != nil {
+				return err
+			}
+			start += n
+		}
+		return nil
+	case w.pc6 != nil:
+		msgs := make([]ipv6.Message, len(bufs))
+		for i, b := range bufs {
+			msgs[i].Buffers = net.Buffers{b}
+		}
+		for start := 0; start < len(msgs); {
+			n, err := w.pc6.WriteBatch(msgs[start:], 0)
+			if err != nil {
+				return err
+			}
+			start += n
+		}
+		return nil
+	default:
+		for _, b := range bufs {
+			if _, err := w.Write(b); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+// sendGSO merges bufs (already validated by eligibleForGSO) into one buffer
+// and writes it in a single sendmsg carrying a UDP_SEGMENT cmsg, letting the
+// kernel split it back into segSize-sized datagrams on the wire. udpConn is
+// dialed/connected, so no destination address is needed.
+func (w *wgConn) sendGSO(bufs [][]byte, segSize int) error {
+	total := 0
+	for _, b := range bufs {
+		total += len(b)
+	}
+	merged := make([]byte, 0, total)
+	for _, b := range bufs {
+		merged = append(merged, b...)
+	}
+	oob := appendSegmentSizeMsg(nil, uint16(segSize))
+	_, _, err := w.udpConn.WriteMsgUDP(merged, oob, nil)
+	return err
 }
 
 func (w *wgConn) Close() error {
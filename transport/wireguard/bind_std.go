@@ -8,24 +8,21 @@ package wireguard
 import (
 	"context"
 	"errors"
+	"fmt"
 	"net"
 	"net/netip"
 	"runtime"
 	"strconv"
 	"sync"
+	"sync/atomic"
 	"syscall"
-	_ "unsafe"
 
 	"golang.org/x/net/ipv4"
 	"golang.org/x/net/ipv6"
 	wg "golang.zx2c4.com/wireguard/conn"
-)
-
-//go:linkname getSrcFromControl golang.zx2c4.com/wireguard/conn.getSrcFromControl
-func getSrcFromControl(control []byte, ep *wg.StdNetEndpoint)
 
-//go:linkname setSrcControl golang.zx2c4.com/wireguard/conn.setSrcControl
-func setSrcControl(control *[]byte, ep *wg.StdNetEndpoint)
+	"github.com/Dreamacro/clash/transport/wireguard/sticky"
+)
 
 var _ wg.Bind = (*StdNetBind)(nil)
 
@@ -38,22 +35,75 @@ type StdNetBind struct {
 	ipv4PC     *ipv4.PacketConn // will be nil on non-Linux
 	ipv6PC     *ipv6.PacketConn // will be nil on non-Linux
 
+	// udp{4,6}GSO/GRO cache whether UDP_SEGMENT/UDP_GRO are usable on the
+	// respective socket, probed once in Open. GSO is permanently disabled
+	// the first time a GSO sendmsg fails with EIO or EINVAL (see
+	// isGSOFatal); no count of failures is kept, so one such error is enough.
+	udp4GSO atomic.Bool
+	udp4GRO atomic.Bool
+	udp6GSO atomic.Bool
+	udp6GRO atomic.Bool
+
 	udpAddrPool  sync.Pool // following fields are not guarded by mu
 	ipv4MsgsPool sync.Pool
 	ipv6MsgsPool sync.Pool
 
+	// srcCache remembers, per remote endpoint, the local address/interface
+	// its last datagram arrived on, so replies keep going out the same way
+	// instead of letting routing pick a new egress (sticky source address).
+	srcMu    sync.Mutex
+	srcCache map[netip.AddrPort]sticky.Endpoint
+
 	controlFns    []func(network, address string, c syscall.RawConn) error
 	interfaceName string
-	reserved      []byte
+	mark          uint32
+
+	// reserved holds the per-peer reserved header bytes the listener side
+	// configures via PeerOption.Reserved, keyed by that peer's remote
+	// endpoint - mirroring WgBind's per-endpoint reserved map, since unlike
+	// WgBind, StdNetBind serves every peer of a listener off one shared
+	// socket and has no per-peer connection to hang the bytes off of.
+	reservedMu sync.Mutex
+	reserved   map[netip.AddrPort][]byte
+}
+
+// SetReserved records the 3 reserved header bytes to rewrite on outgoing
+// packets to ep, the same per-endpoint obfuscation knob WgBind.SetReserved
+// offers on the outbound side.
+func (s *StdNetBind) SetReserved(ep netip.AddrPort, reserved []byte) {
+	s.reservedMu.Lock()
+	defer s.reservedMu.Unlock()
+	s.reserved[ep] = reserved
+}
+
+func (s *StdNetBind) reservedFor(ep netip.AddrPort) []byte {
+	s.reservedMu.Lock()
+	defer s.reservedMu.Unlock()
+	return s.reserved[ep]
+}
+
+func (s *StdNetBind) storeSrc(remote netip.AddrPort, src sticky.Endpoint) {
+	if !src.IsValid() {
+		return
+	}
+	s.srcMu.Lock()
+	s.srcCache[remote] = src
+	s.srcMu.Unlock()
+}
+
+func (s *StdNetBind) loadSrc(remote netip.AddrPort) sticky.Endpoint {
+	s.srcMu.Lock()
+	defer s.srcMu.Unlock()
+	return s.srcCache[remote]
 }
 
-func (s *StdNetBind) setReserved(b []byte) {
-	if len(b) < 4 || s.reserved == nil {
+func (s *StdNetBind) setReserved(b []byte, reserved []byte) {
+	if len(b) < 4 || reserved == nil {
 		return
 	}
-	b[1] = s.reserved[0]
-	b[2] = s.reserved[1]
-	b[3] = s.reserved[2]
+	b[1] = reserved[0]
+	b[2] = reserved[1]
+	b[3] = reserved[2]
 }
 
 func (s *StdNetBind) resetReserved(b []byte) {
@@ -78,6 +128,45 @@ func (s *StdNetBind) listenConfig() *net.ListenConfig {
 	}
 }
 
+// getListenIP resolves the local IP listenNet should bind to for network
+// ("udp4" or "udp6"). With no interfaceName it returns "" (the wildcard
+// address, i.e. the previous no-interface-pinning behavior). Otherwise it
+// picks interfaceName's first address of the matching family - the
+// fallback bindToDeviceControl's doc comments point callers at on platforms
+// (FreeBSD, OpenBSD) that have no SO_BINDTODEVICE equivalent to pin egress
+// by interface name alone.
+func getListenIP(network, interfaceName string) (string, error) {
+	if interfaceName == "" {
+		return "", nil
+	}
+
+	iface, err := net.InterfaceByName(interfaceName)
+	if err != nil {
+		return "", fmt.Errorf("resolve wireguard bind interface %s failure, cause: %w", interfaceName, err)
+	}
+	addrs, err := iface.Addrs()
+	if err != nil {
+		return "", fmt.Errorf("list addresses for wireguard bind interface %s failure, cause: %w", interfaceName, err)
+	}
+
+	wantV6 := network == "udp6"
+	for _, a := range addrs {
+		ipNet, ok := a.(*net.IPNet)
+		if !ok {
+			continue
+		}
+		ip, ok := netip.AddrFromSlice(ipNet.IP)
+		if !ok {
+			continue
+		}
+		ip = ip.Unmap()
+		if ip.Is6() == wantV6 {
+			return ip.String(), nil
+		}
+	}
+	return "", fmt.Errorf("interface %s has no %s address", interfaceName, network)
+}
+
 func (s *StdNetBind) listenNet(network string, port int) (*net.UDPConn, int, error) {
 	listenIP, err := getListenIP(network, s.interfaceName)
 	if err != nil {
@@ -101,8 +190,25 @@ func (s *StdNetBind) listenNet(network string, port int) (*net.UDPConn, int, err
 	return conn.(*net.UDPConn), uaddr.Port, nil
 }
 
+// SetMark applies mark to the bind's sockets, restoring parity with upstream
+// wireguard-go, which calls this on handshake retries and roaming to keep
+// the fwmark (used for policy routing) current as the peer's path changes.
 func (s *StdNetBind) SetMark(mark uint32) error {
-	return nil
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.mark = mark
+
+	var err4, err6 error
+	if s.ipv4 != nil {
+		err4 = setSocketMark(s.ipv4, mark)
+	}
+	if s.ipv6 != nil {
+		err6 = setSocketMark(s.ipv6, mark)
+	}
+	if err4 != nil {
+		return err4
+	}
+	return err6
 }
 
 func (s *StdNetBind) UpdateControlFns(controlFns []func(network, address string, c syscall.RawConn) error) {
@@ -112,8 +218,15 @@ func (s *StdNetBind) UpdateControlFns(controlFns []func(network, address string,
 func NewStdNetBind(
 	controlFns []func(network, address string, c syscall.RawConn) error,
 	interfaceName string,
-	reserved []byte,
+	routingMark uint32,
 ) wg.Bind {
+	if routingMark != 0 {
+		controlFns = append(controlFns, markControl(routingMark))
+	}
+	if interfaceName != "" {
+		controlFns = append(controlFns, bindToDeviceControl(interfaceName))
+	}
+
 	return &StdNetBind{
 		udpAddrPool: sync.Pool{
 			New: func() any {
@@ -128,7 +241,7 @@ func NewStdNetBind(
 				msgs := make([]ipv4.Message, wg.IdealBatchSize)
 				for i := range msgs {
 					msgs[i].Buffers = make(net.Buffers, 1)
-					msgs[i].OOB = make([]byte, srcControlSize)
+					msgs[i].OOB = make([]byte, sticky.ControlSize()+cmsgSpaceUint16)
 				}
 				return &msgs
 			},
@@ -139,15 +252,17 @@ func NewStdNetBind(
 				msgs := make([]ipv6.Message, wg.IdealBatchSize)
 				for i := range msgs {
 					msgs[i].Buffers = make(net.Buffers, 1)
-					msgs[i].OOB = make([]byte, srcControlSize)
+					msgs[i].OOB = make([]byte, sticky.ControlSize()+cmsgSpaceUint16)
 				}
 				return &msgs
 			},
 		},
 
+		srcCache:      make(map[netip.AddrPort]sticky.Endpoint),
 		controlFns:    controlFns,
 		interfaceName: interfaceName,
-		reserved:      reserved,
+		reserved:      make(map[netip.AddrPort][]byte),
+		mark:          routingMark,
 	}
 }
 
@@ -196,6 +311,9 @@ again:
 		if runtime.GOOS == "linux" {
 			v4pc = ipv4.NewPacketConn(v4conn)
 			s.ipv4PC = v4pc
+			gso, gro := supportsUDPOffload(v4conn)
+			s.udp4GSO.Store(gso)
+			s.udp4GRO.Store(gro)
 		}
 		fns = append(fns, s.makeReceiveIPv4(v4pc, v4conn))
 		s.ipv4 = v4conn
@@ -204,6 +322,9 @@ again:
 		if runtime.GOOS == "linux" {
 			v6pc = ipv6.NewPacketConn(v6conn)
 			s.ipv6PC = v6pc
+			gso, gro := supportsUDPOffload(v6conn)
+			s.udp6GSO.Store(gso)
+			s.udp6GRO.Store(gro)
 		}
 		fns = append(fns, s.makeReceiveIPv6(v6pc, v6conn))
 		s.ipv6 = v6conn
@@ -236,16 +357,28 @@ func (s *StdNetBind) makeReceiveIPv4(pc *ipv4.PacketConn, conn *net.UDPConn) wg.
 			}
 			numMsgs = 1
 		}
+		out := 0
 		for i := 0; i < numMsgs; i++ {
 			msg := &(*msgs)[i]
-			sizes[i] = msg.N
 			addrPort := msg.Addr.(*net.UDPAddr).AddrPort()
 			ep := asEndpoint(addrPort)
-			getSrcFromControl(msg.OOB[:msg.NN], ep)
-			eps[i] = ep
+			s.storeSrc(addrPort, sticky.GetSrc(msg.OOB[:msg.NN]))
+
+			if s.udp4GRO.Load() {
+				if segSize := parseGROSegmentSize(msg.OOB[:msg.NN]); segSize > 0 && segSize < msg.N {
+					out += splitGROSegments(msg.Buffers[0][:msg.N], segSize, bufs[out:], sizes[out:], eps[out:], ep, s.resetReserved)
+					continue
+				}
+			}
+			if out >= len(bufs) {
+				break
+			}
+			sizes[out] = msg.N
+			eps[out] = ep
 			s.resetReserved(msg.Buffers[0])
+			out++
 		}
-		return numMsgs, nil
+		return out, nil
 	}
 }
 
@@ -270,17 +403,49 @@ func (s *StdNetBind) makeReceiveIPv6(pc *ipv6.PacketConn, conn *net.UDPConn) wg.
 			}
 			numMsgs = 1
 		}
+		out := 0
 		for i := 0; i < numMsgs; i++ {
 			msg := &(*msgs)[i]
-			sizes[i] = msg.N
 			addrPort := msg.Addr.(*net.UDPAddr).AddrPort()
 			ep := asEndpoint(addrPort)
-			getSrcFromControl(msg.OOB[:msg.NN], ep)
-			eps[i] = ep
+			s.storeSrc(addrPort, sticky.GetSrc(msg.OOB[:msg.NN]))
+
+			if s.udp6GRO.Load() {
+				if segSize := parseGROSegmentSize(msg.OOB[:msg.NN]); segSize > 0 && segSize < msg.N {
+					out += splitGROSegments(msg.Buffers[0][:msg.N], segSize, bufs[out:], sizes[out:], eps[out:], ep, s.resetReserved)
+					continue
+				}
+			}
+			if out >= len(bufs) {
+				break
+			}
+			sizes[out] = msg.N
+			eps[out] = ep
 			s.resetReserved(msg.Buffers[0])
+			out++
+		}
+		return out, nil
+	}
+}
+
+// splitGROSegments splits a single GRO-coalesced datagram of total length
+// len(data) into segSize-sized pieces (the trailing piece may be shorter),
+// copying each into the next available slot in bufs and resetting the
+// WireGuard reserved bytes on it. It returns the number of slots filled.
+func splitGROSegments(data []byte, segSize int, bufs [][]byte, sizes []int, eps []wg.Endpoint, ep wg.Endpoint, resetReserved func([]byte)) int {
+	n := 0
+	for len(data) > 0 && n < len(bufs) {
+		chunk := segSize
+		if chunk > len(data) {
+			chunk = len(data)
 		}
-		return numMsgs, nil
+		sizes[n] = copy(bufs[n], data[:chunk])
+		eps[n] = ep
+		resetReserved(bufs[n])
+		data = data[chunk:]
+		n++
 	}
+	return n
 }
 
 // TODO: When all Binds handle IdealBatchSize, remove this dynamic function and
@@ -341,8 +506,9 @@ func (s *StdNetBind) Send(bufs [][]byte, endpoint wg.Endpoint) error {
 		return syscall.EAFNOSUPPORT
 	}
 
+	reserved := s.reservedFor(endpoint.(*wg.StdNetEndpoint).AddrPort)
 	for i := range bufs {
-		s.setReserved(bufs[i])
+		s.setReserved(bufs[i], reserved)
 	}
 
 	if is6 {
@@ -358,11 +524,32 @@ func (s *StdNetBind) send4(conn *net.UDPConn, pc *ipv4.PacketConn, ep wg.Endpoin
 	copy(ua.IP, as4[:])
 	ua.IP = ua.IP[:4]
 	ua.Port = int(ep.(*wg.StdNetEndpoint).Port())
+
+	if s.udp4GSO.Load() {
+		if segSize, ok := eligibleForGSO(bufs); ok {
+			err := s.sendGSO(conn, ua, ep, bufs, segSize)
+			s.udpAddrPool.Put(ua)
+			if err == nil {
+				return nil
+			}
+			if isGSOFatal(err) {
+				s.udp4GSO.Store(false)
+				ua = s.udpAddrPool.Get().(*net.UDPAddr)
+				copy(ua.IP, as4[:])
+				ua.IP = ua.IP[:4]
+				ua.Port = int(ep.(*wg.StdNetEndpoint).Port())
+			} else {
+				return err
+			}
+		}
+	}
+
+	src := s.loadSrc(ep.(*wg.StdNetEndpoint).AddrPort)
 	msgs := s.ipv4MsgsPool.Get().(*[]ipv4.Message)
 	for i, buf := range bufs {
 		(*msgs)[i].Buffers[0] = buf
 		(*msgs)[i].Addr = ua
-		setSrcControl(&(*msgs)[i].OOB, ep.(*wg.StdNetEndpoint))
+		(*msgs)[i].OOB = sticky.SetSrc((*msgs)[i].OOB[:0], src)
 	}
 	var (
 		n     int
@@ -396,11 +583,32 @@ func (s *StdNetBind) send6(conn *net.UDPConn, pc *ipv6.PacketConn, ep wg.Endpoin
 	copy(ua.IP, as16[:])
 	ua.IP = ua.IP[:16]
 	ua.Port = int(ep.(*wg.StdNetEndpoint).Port())
+
+	if s.udp6GSO.Load() {
+		if segSize, ok := eligibleForGSO(bufs); ok {
+			err := s.sendGSO(conn, ua, ep, bufs, segSize)
+			s.udpAddrPool.Put(ua)
+			if err == nil {
+				return nil
+			}
+			if isGSOFatal(err) {
+				s.udp6GSO.Store(false)
+				ua = s.udpAddrPool.Get().(*net.UDPAddr)
+				copy(ua.IP, as16[:])
+				ua.IP = ua.IP[:16]
+				ua.Port = int(ep.(*wg.StdNetEndpoint).Port())
+			} else {
+				return err
+			}
+		}
+	}
+
+	src := s.loadSrc(ep.(*wg.StdNetEndpoint).AddrPort)
 	msgs := s.ipv6MsgsPool.Get().(*[]ipv6.Message)
 	for i, buf := range bufs {
 		(*msgs)[i].Buffers[0] = buf
 		(*msgs)[i].Addr = ua
-		setSrcControl(&(*msgs)[i].OOB, ep.(*wg.StdNetEndpoint))
+		(*msgs)[i].OOB = sticky.SetSrc((*msgs)[i].OOB[:0], src)
 	}
 	var (
 		n     int
@@ -428,6 +636,54 @@ func (s *StdNetBind) send6(conn *net.UDPConn, pc *ipv6.PacketConn, ep wg.Endpoin
 	return err
 }
 
+// eligibleForGSO reports whether bufs can be coalesced into a single
+// UDP_SEGMENT sendmsg: every buffer but the last must share the same size,
+// and the last may only be equal or shorter.
+func eligibleForGSO(bufs [][]byte) (segSize int, ok bool) {
+	if len(bufs) < 2 {
+		return 0, false
+	}
+	segSize = len(bufs[0])
+	if segSize == 0 {
+		return 0, false
+	}
+	for i, b := range bufs {
+		if i < len(bufs)-1 {
+			if len(b) != segSize {
+				return 0, false
+			}
+		} else if len(b) > segSize {
+			return 0, false
+		}
+	}
+	return segSize, true
+}
+
+// sendGSO coalesces bufs (already validated by eligibleForGSO) into a
+// single sendmsg carrying a UDP_SEGMENT cmsg, letting the kernel split them
+// back into segSize-sized datagrams on the wire.
+func (s *StdNetBind) sendGSO(conn *net.UDPConn, ua *net.UDPAddr, ep wg.Endpoint, bufs [][]byte, segSize int) error {
+	total := 0
+	for _, b := range bufs {
+		total += len(b)
+	}
+	merged := make([]byte, 0, total)
+	for _, b := range bufs {
+		merged = append(merged, b...)
+	}
+	oob := appendSegmentSizeMsg(nil, uint16(segSize))
+	oob = sticky.SetSrc(oob, s.loadSrc(ep.(*wg.StdNetEndpoint).AddrPort))
+	_, _, err := conn.WriteMsgUDP(merged, oob, ua)
+	return err
+}
+
+// isGSOFatal reports whether err indicates the kernel/NIC rejected the
+// UDP_SEGMENT cmsg outright, in which case GSO should be permanently
+// disabled for that socket rather than retried.
+func isGSOFatal(err error) bool {
+	return errors.Is(err, syscall.EIO) || errors.Is(err, syscall.EINVAL)
+}
+
 // endpointPool contains a re-usable set of mapping from netip.AddrPort to Endpoint.
 // This exists to reduce allocations: Putting a netip.AddrPort in an Endpoint allocates,
 // but Endpoints are immutable, so we can re-use them.
@@ -0,0 +1,113 @@
+package wireguard
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	wg "golang.zx2c4.com/wireguard/conn"
+)
+
+// TestStdNetBindNoGSOFallback exercises StdNetBind's send path with
+// UDP_SEGMENT support left off - the state supportsUDPOffload leaves
+// udp4GSO/udp6GSO in on any kernel that doesn't support it, since the
+// SetsockoptInt probe in supportsUDPOffload simply fails there. It confirms
+// multiple differently-sized buffers still all arrive correctly through the
+// plain WriteBatch/Write path, rather than silently relying on GSO working.
+func TestStdNetBindNoGSOFallback(t *testing.T) {
+	serverBind, ok := NewStdNetBind(nil, "", 0).(*StdNetBind)
+	if !ok {
+		t.Fatalf("NewStdNetBind did not return a *StdNetBind")
+	}
+	serverFns, serverPort, err := serverBind.Open(0)
+	if err != nil {
+		t.Fatalf("server Open: %v", err)
+	}
+	defer func() { _ = serverBind.Close() }()
+	if serverBind.ipv4 != nil {
+		_ = serverBind.ipv4.SetReadDeadline(time.Now().Add(5 * time.Second))
+	}
+
+	clientBind, ok := NewStdNetBind(nil, "", 0).(*StdNetBind)
+	if !ok {
+		t.Fatalf("NewStdNetBind did not return a *StdNetBind")
+	}
+	if _, _, err = clientBind.Open(0); err != nil {
+		t.Fatalf("client Open: %v", err)
+	}
+	defer func() { _ = clientBind.Close() }()
+
+	// Open has probed the sockets for UDP_SEGMENT, so force udp4GSO/udp6GSO
+	// off - exactly the state a kernel lacking UDP_SEGMENT support would
+	// leave them in after supportsUDPOffload's setsockopt probe fails.
+	clientBind.udp4GSO.Store(false)
+	clientBind.udp6GSO.Store(false)
+	ep, err := clientBind.ParseEndpoint(fmt.Sprintf("127.0.0.1:%d", serverPort))
+	if err != nil {
+		t.Fatalf("ParseEndpoint: %v", err)
+	}
+
+	want := [][]byte{
+		makeWgPacket(1, "alpha"),
+		makeWgPacket(2, "bravo-body"),
+		makeWgPacket(3, "c"),
+	}
+	if err = clientBind.Send(want, ep); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+
+	recv := serverFns[0]
+	bufs := make([][]byte, len(want))
+	sizes := make([]int, len(want))
+	eps := make([]wg.Endpoint, len(want))
+	for i := range bufs {
+		bufs[i] = make([]byte, 64)
+	}
+
+	got := 0
+	for got < len(want) {
+		n, err := recv(bufs[got:], sizes[got:], eps[got:])
+		if err != nil {
+			t.Fatalf("receive: %v", err)
+		}
+		got += n
+	}
+
+	for i, w := range want {
+		expected := make([]byte, len(w))
+		copy(expected, w)
+		expected[1], expected[2], expected[3] = 0, 0, 0 // resetReserved
+		if gotBuf := bufs[i][:sizes[i]]; string(gotBuf) != string(expected) {
+			t.Fatalf("packet %d: got %q, want %q", i, gotBuf, expected)
+		}
+	}
+}
+
+// TestEligibleForGSO checks the batching precondition sendGSO relies on:
+// every buffer but the last must share one size, and the trailing one may
+// only be equal or shorter - the shape a kernel without UDP_SEGMENT support
+// would never get offered a batch satisfying anyway, since eligibleForGSO
+// gates whether sendGSO is even attempted.
+func TestEligibleForGSO(t *testing.T) {
+	cases := []struct {
+		name    string
+		bufs    [][]byte
+		wantOK  bool
+		wantSeg int
+	}{
+		{"single buffer", [][]byte{{1, 2, 3}}, false, 0},
+		{"uniform sizes", [][]byte{{1, 2}, {3, 4}, {5, 6}}, true, 2},
+		{"shorter trailing buffer", [][]byte{{1, 2}, {3, 4}, {5}}, true, 2},
+		{"mismatched non-trailing size", [][]byte{{1, 2}, {3}, {4, 5}}, false, 0},
+		{"longer trailing buffer", [][]byte{{1, 2}, {3, 4, 5}}, false, 0},
+		{"empty leading buffer", [][]byte{{}, {1}}, false, 0},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			segSize, ok := eligibleForGSO(c.bufs)
+			if ok != c.wantOK || (ok && segSize != c.wantSeg) {
+				t.Fatalf("eligibleForGSO(%v) = (%d, %v), want (%d, %v)", c.bufs, segSize, ok, c.wantSeg, c.wantOK)
+			}
+		})
+	}
+}
@@ -0,0 +1,126 @@
+package wireguard
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync"
+
+	"golang.zx2c4.com/wireguard/tun"
+	"gvisor.dev/gvisor/pkg/buffer"
+	"gvisor.dev/gvisor/pkg/tcpip"
+	"gvisor.dev/gvisor/pkg/tcpip/header"
+	"gvisor.dev/gvisor/pkg/tcpip/link/channel"
+	"gvisor.dev/gvisor/pkg/tcpip/network/ipv4"
+	"gvisor.dev/gvisor/pkg/tcpip/network/ipv6"
+	"gvisor.dev/gvisor/pkg/tcpip/stack"
+	"gvisor.dev/gvisor/pkg/tcpip/transport/tcp"
+	"gvisor.dev/gvisor/pkg/tcpip/transport/udp"
+)
+
+const gatewayNICID tcpip.NICID = 1
+
+// CreateGatewayNetTUN builds a gVisor netstack the same way CreateNetTUN
+// does, except the returned *stack.Stack is promiscuous/spoofing and has no
+// addresses of its own: it accepts traffic for any destination so a caller
+// can register tcp.Forwarder/udp.Forwarder handlers and act as a transparent
+// gateway, rather than only dialing out as Net does.
+func CreateGatewayNetTUN(mtu int) (tun.Device, *stack.Stack, error) {
+	s := stack.New(stack.Options{
+		NetworkProtocols:   []stack.NetworkProtocolFactory{ipv4.NewProtocol, ipv6.NewProtocol},
+		TransportProtocols: []stack.TransportProtocolFactory{tcp.NewProtocol, udp.NewProtocol},
+	})
+
+	ep := channel.New(1024, uint32(mtu), "")
+	if err := s.CreateNIC(gatewayNICID, ep); err != nil {
+		return nil, nil, fmt.Errorf("create wireguard gateway nic failure: %s", err)
+	}
+	if err := s.SetPromiscuousMode(gatewayNICID, true); err != nil {
+		return nil, nil, fmt.Errorf("enable wireguard gateway promiscuous mode failure: %s", err)
+	}
+	if err := s.SetSpoofing(gatewayNICID, true); err != nil {
+		return nil, nil, fmt.Errorf("enable wireguard gateway spoofing failure: %s", err)
+	}
+	s.SetRouteTable([]tcpip.Route{
+		{Destination: header.IPv4EmptySubnet, NIC: gatewayNICID},
+		{Destination: header.IPv6EmptySubnet, NIC: gatewayNICID},
+	})
+
+	events := make(chan tun.Event, 1)
+	events <- tun.EventUp
+
+	return &gatewayTUN{ep: ep, stack: s, events: events, mtu: mtu}, s, nil
+}
+
+// gatewayTUN adapts a gVisor channel.Endpoint to the wireguard-go tun.Device
+// interface, so device.Device can read/write decrypted IP packets straight
+// into the gateway stack instead of an OS TUN.
+type gatewayTUN struct {
+	ep     *channel.Endpoint
+	stack  *stack.Stack
+	events chan tun.Event
+	mtu    int
+
+	closeOnce sync.Once
+}
+
+func (t *gatewayTUN) File() *os.File { return nil }
+
+func (t *gatewayTUN) Read(bufs [][]byte, sizes []int, offset int) (int, error) {
+	pkt := t.ep.ReadContext(context.Background())
+	if pkt == nil {
+		return 0, tun.ErrTooManySegments
+	}
+	defer pkt.DecRef()
+	view := pkt.ToView()
+	defer view.Release()
+	n, err := view.Read(bufs[0][offset:])
+	if err != nil {
+		return 0, err
+	}
+	sizes[0] = n
+	return 1, nil
+}
+
+func (t *gatewayTUN) Write(bufs [][]byte, offset int) (int, error) {
+	for _, b := range bufs {
+		raw := b[offset:]
+		if len(raw) == 0 {
+			continue
+		}
+		var proto tcpip.NetworkProtocolNumber
+		switch header.IPVersion(raw) {
+		case header.IPv4Version:
+			proto = header.IPv4ProtocolNumber
+		case header.IPv6Version:
+			proto = header.IPv6ProtocolNumber
+		default:
+			continue
+		}
+		pkb := stack.NewPacketBuffer(stack.PacketBufferOptions{
+			Payload: buffer.MakeWithData(append([]byte(nil), raw...)),
+		})
+		t.ep.InjectInbound(proto, pkb)
+		pkb.DecRef()
+	}
+	return len(bufs), nil
+}
+
+func (t *gatewayTUN) Flush() error { return nil }
+
+func (t *gatewayTUN) MTU() (int, error) { return t.mtu, nil }
+
+func (t *gatewayTUN) Name() (string, error) { return "wg-gateway", nil }
+
+func (t *gatewayTUN) Events() <-chan tun.Event { return t.events }
+
+func (t *gatewayTUN) BatchSize() int { return 1 }
+
+func (t *gatewayTUN) Close() error {
+	t.closeOnce.Do(func() {
+		close(t.events)
+		t.ep.Close()
+		t.stack.Close()
+	})
+	return nil
+}
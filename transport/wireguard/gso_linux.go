@@ -0,0 +1,77 @@
+/* SPDX-License-Identifier: MIT
+ *
+ * Copyright (C) 2017-2023 WireGuard LLC. All Rights Reserved.
+ */
+
+package wireguard
+
+import (
+	"encoding/binary"
+	"net"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// These mirror the Linux UDP socket option numbers; they are hardcoded
+// because not every supported golang.org/x/sys/unix release exposes them
+// as named constants yet.
+const (
+	udpSegmentOpt = 103 // UDP_SEGMENT
+	udpGROOpt     = 104 // UDP_GRO
+)
+
+// cmsgSpaceUint16 is the OOB space needed to carry a single UDP_SEGMENT or
+// UDP_GRO cmsg (unix.CmsgSpace is not a compile-time constant).
+var cmsgSpaceUint16 = unix.CmsgSpace(2)
+
+// supportsUDPOffload probes conn for UDP_SEGMENT (GSO on send) and UDP_GRO
+// (coalesced receives) support, enabling GRO on the socket as a side effect
+// so the kernel starts coalescing incoming datagrams.
+func supportsUDPOffload(conn *net.UDPConn) (gso bool, gro bool) {
+	rc, err := conn.SyscallConn()
+	if err != nil {
+		return false, false
+	}
+	_ = rc.Control(func(fd uintptr) {
+		if err := unix.SetsockoptInt(int(fd), unix.IPPROTO_UDP, udpSegmentOpt, 1500); err == nil {
+			if v, err := unix.GetsockoptInt(int(fd), unix.IPPROTO_UDP, udpSegmentOpt); err == nil && v > 0 {
+				gso = true
+			}
+		}
+		if err := unix.SetsockoptInt(int(fd), unix.IPPROTO_UDP, udpGROOpt, 1); err == nil {
+			if v, err := unix.GetsockoptInt(int(fd), unix.IPPROTO_UDP, udpGROOpt); err == nil && v > 0 {
+				gro = true
+			}
+		}
+	})
+	return
+}
+
+// appendSegmentSizeMsg appends a UDP_SEGMENT cmsg carrying segmentSize to
+// control and returns the extended slice.
+func appendSegmentSizeMsg(control []byte, segmentSize uint16) []byte {
+	existing := len(control)
+	control = append(control, make([]byte, cmsgSpaceUint16)...)
+	hdr := (*unix.Cmsghdr)(unsafe.Pointer(&control[existing]))
+	hdr.Level = unix.IPPROTO_UDP
+	hdr.Type = udpSegmentOpt
+	hdr.SetLen(unix.CmsgLen(2))
+	binary.NativeEndian.PutUint16(control[existing+unix.CmsgLen(0):], segmentSize)
+	return control
+}
+
+// parseGROSegmentSize scans control for a UDP_GRO cmsg and returns the
+// segment size the kernel coalesced the datagram with, or 0 if absent.
+func parseGROSegmentSize(control []byte) int {
+	msgs, err := unix.ParseSocketControlMessage(control)
+	if err != nil {
+		return 0
+	}
+	for _, m := range msgs {
+		if m.Header.Level == unix.IPPROTO_UDP && m.Header.Type == udpGROOpt && len(m.Data) >= 2 {
+			return int(binary.NativeEndian.Uint16(m.Data))
+		}
+	}
+	return 0
+}
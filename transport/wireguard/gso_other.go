@@ -0,0 +1,21 @@
+//go:build !linux
+
+package wireguard
+
+import "net"
+
+// cmsgSpaceUint16 is unused outside Linux; kept so shared code can still
+// size OOB buffers without a build-tag switch at every call site.
+var cmsgSpaceUint16 = 0
+
+func supportsUDPOffload(_ *net.UDPConn) (gso bool, gro bool) {
+	return false, false
+}
+
+func appendSegmentSizeMsg(control []byte, _ uint16) []byte {
+	return control
+}
+
+func parseGROSegmentSize(_ []byte) int {
+	return 0
+}
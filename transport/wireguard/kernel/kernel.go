@@ -0,0 +1,48 @@
+// Package kernel drives the in-kernel WireGuard driver (Linux wireguard(4),
+// configured over genetlink) as an alternative to running device.Device and
+// a userspace netstack, for proxies that can grant CAP_NET_ADMIN and want
+// near line-rate throughput. The kernel interface is paired with a dedicated
+// routing table and fwmark, and the caller dials ordinary sockets marked
+// with that fwmark (see MarkControl; the same mechanism outbound.Base
+// already uses for RoutingMark) to have them routed into it.
+package kernel
+
+import (
+	"errors"
+	"net/netip"
+)
+
+// ErrUnsupported is returned by New on platforms with no kernel WireGuard
+// backend. On Linux, a missing driver or privilege surfaces as New's
+// wrapped netlink/wgctrl error instead.
+var ErrUnsupported = errors.New("kernel wireguard backend not available on this platform")
+
+// PeerConfig configures one peer of a kernel-mode WireGuard device.
+type PeerConfig struct {
+	PublicKey                   string
+	PresharedKey                string
+	Endpoint                    netip.AddrPort
+	AllowedIPs                  []netip.Prefix
+	PersistentKeepaliveInterval int
+}
+
+// Config describes a kernel-mode WireGuard device to create.
+type Config struct {
+	// Name is the network interface name, e.g. "wg-clash0".
+	Name       string
+	PrivateKey string
+	ListenPort int
+
+	// Table is the dedicated routing table AllowedIPs routes are installed
+	// into, and FwMark is the fwmark an `ip rule` sends to that table -
+	// callers dial out through the device by marking their sockets FwMark.
+	Table  int
+	FwMark int
+
+	Peers []PeerConfig
+}
+
+// Device is a running kernel-mode WireGuard interface.
+type Device interface {
+	Close() error
+}
@@ -0,0 +1,177 @@
+//go:build linux
+
+package kernel
+
+import (
+	"fmt"
+	"net"
+	"net/netip"
+	"syscall"
+	"time"
+
+	"github.com/vishvananda/netlink"
+	"golang.org/x/sys/unix"
+	"golang.zx2c4.com/wireguard/wgctrl"
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+)
+
+// MarkControl returns a dialer Control function that tags the socket with
+// fwmark, so the `ip rule` New installed routes it into the kernel device's
+// table instead of the default one.
+func MarkControl(fwmark int) func(network, address string, c syscall.RawConn) error {
+	return func(_, _ string, c syscall.RawConn) error {
+		var sockErr error
+		if err := c.Control(func(fd uintptr) {
+			sockErr = unix.SetsockoptInt(int(fd), unix.SOL_SOCKET, unix.SO_MARK, fwmark)
+		}); err != nil {
+			return err
+		}
+		return sockErr
+	}
+}
+
+// Available reports whether this process can plausibly create a kernel
+// WireGuard device: the wireguard(4) driver must be loaded (or loadable)
+// and we need CAP_NET_ADMIN. There's no cheap way to check either short
+// of trying, so this only checks that a wgctrl client can be opened; that
+// also succeeds without the "wireguard" genetlink family, so a true result
+// does not guarantee New will succeed.
+func Available() bool {
+	c, err := wgctrl.New()
+	if err != nil {
+		return false
+	}
+	_ = c.Close()
+	return true
+}
+
+type linuxDevice struct {
+	link   netlink.Link
+	wg     *wgctrl.Client
+	rule   *netlink.Rule
+	routes []netlink.Route
+}
+
+func prefixToIPNet(p netip.Prefix) *net.IPNet {
+	return &net.IPNet{
+		IP:   p.Addr().AsSlice(),
+		Mask: net.CIDRMask(p.Bits(), p.Addr().BitLen()),
+	}
+}
+
+// New creates a kernel WireGuard interface, configures its keys/peers over
+// genetlink, and installs cfg.Peers' AllowedIPs as routes in cfg.Table, with
+// an `ip rule` sending fwmark cfg.FwMark traffic to that table.
+func New(cfg Config) (Device, error) {
+	privateKey, err := wgtypes.ParseKey(cfg.PrivateKey)
+	if err != nil {
+		return nil, fmt.Errorf("parse kernel wireguard private key failure, cause: %w", err)
+	}
+
+	link := &netlink.GenericLink{
+		LinkAttrs: netlink.LinkAttrs{Name: cfg.Name},
+		LinkType:  "wireguard",
+	}
+	if err = netlink.LinkAdd(link); err != nil {
+		return nil, fmt.Errorf("create kernel wireguard interface failure, cause: %w", err)
+	}
+	d := &linuxDevice{link: link}
+
+	wgClient, err := wgctrl.New()
+	if err != nil {
+		d.Close()
+		return nil, fmt.Errorf("open wireguard control socket failure, cause: %w", err)
+	}
+	d.wg = wgClient
+
+	peerConfigs := make([]wgtypes.PeerConfig, 0, len(cfg.Peers))
+	for _, peer := range cfg.Peers {
+		publicKey, err := wgtypes.ParseKey(peer.PublicKey)
+		if err != nil {
+			d.Close()
+			return nil, fmt.Errorf("parse kernel wireguard peer public key failure, cause: %w", err)
+		}
+
+		pc := wgtypes.PeerConfig{
+			PublicKey:  publicKey,
+			AllowedIPs: make([]net.IPNet, 0, len(peer.AllowedIPs)),
+		}
+		if peer.PresharedKey != "" {
+			psk, err := wgtypes.ParseKey(peer.PresharedKey)
+			if err != nil {
+				d.Close()
+				return nil, fmt.Errorf("parse kernel wireguard peer preshared key failure, cause: %w", err)
+			}
+			pc.PresharedKey = &psk
+		}
+		if peer.Endpoint.IsValid() {
+			pc.Endpoint = net.UDPAddrFromAddrPort(peer.Endpoint)
+		}
+		if peer.PersistentKeepaliveInterval > 0 {
+			interval := time.Duration(peer.PersistentKeepaliveInterval) * time.Second
+			pc.PersistentKeepaliveInterval = &interval
+		}
+		for _, allowed := range peer.AllowedIPs {
+			pc.AllowedIPs = append(pc.AllowedIPs, *prefixToIPNet(allowed))
+		}
+		peerConfigs = append(peerConfigs, pc)
+	}
+
+	wgConfig := wgtypes.Config{
+		PrivateKey:   &privateKey,
+		ListenPort:   &cfg.ListenPort,
+		ReplacePeers: true,
+		Peers:        peerConfigs,
+	}
+	if err = wgClient.ConfigureDevice(cfg.Name, wgConfig); err != nil {
+		d.Close()
+		return nil, fmt.Errorf("configure kernel wireguard device failure, cause: %w", err)
+	}
+
+	if err = netlink.LinkSetUp(link); err != nil {
+		d.Close()
+		return nil, fmt.Errorf("bring up kernel wireguard interface failure, cause: %w", err)
+	}
+
+	for _, peer := range cfg.Peers {
+		for _, allowed := range peer.AllowedIPs {
+			route := netlink.Route{
+				LinkIndex: link.Attrs().Index,
+				Dst:       prefixToIPNet(allowed),
+				Table:     cfg.Table,
+			}
+			if err = netlink.RouteAdd(&route); err != nil {
+				d.Close()
+				return nil, fmt.Errorf("add kernel wireguard route failure, cause: %w", err)
+			}
+			d.routes = append(d.routes, route)
+		}
+	}
+
+	rule := netlink.NewRule()
+	rule.Mark = cfg.FwMark
+	rule.Table = cfg.Table
+	if err = netlink.RuleAdd(rule); err != nil {
+		d.Close()
+		return nil, fmt.Errorf("add kernel wireguard routing rule failure, cause: %w", err)
+	}
+	d.rule = rule
+
+	return d, nil
+}
+
+func (d *linuxDevice) Close() error {
+	if d.rule != nil {
+		_ = netlink.RuleDel(d.rule)
+	}
+	for i := range d.routes {
+		_ = netlink.RouteDel(&d.routes[i])
+	}
+	if d.wg != nil {
+		_ = d.wg.Close()
+	}
+	if d.link != nil {
+		_ = netlink.LinkDel(d.link)
+	}
+	return nil
+}
@@ -0,0 +1,15 @@
+//go:build !linux
+
+package kernel
+
+import "syscall"
+
+func Available() bool { return false }
+
+func New(_ Config) (Device, error) {
+	return nil, ErrUnsupported
+}
+
+func MarkControl(_ int) func(network, address string, c syscall.RawConn) error {
+	return func(string, string, syscall.RawConn) error { return nil }
+}
@@ -0,0 +1,45 @@
+package wireguard
+
+import (
+	"net"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// setSocketMark applies fwmark to conn's underlying socket via SO_USER_COOKIE,
+// FreeBSD's equivalent of Linux's SO_MARK.
+func setSocketMark(conn *net.UDPConn, mark uint32) error {
+	rc, err := conn.SyscallConn()
+	if err != nil {
+		return err
+	}
+	var sockErr error
+	if err = rc.Control(func(fd uintptr) {
+		sockErr = unix.SetsockoptInt(int(fd), unix.SOL_SOCKET, unix.SO_USER_COOKIE, int(mark))
+	}); err != nil {
+		return err
+	}
+	return sockErr
+}
+
+// markControl returns a dialer/listener Control function that applies mark
+// to a newly created socket before it's bound, so RoutingMark takes effect
+// on the very first packet rather than only after a later SetMark call.
+func markControl(mark uint32) func(network, address string, c syscall.RawConn) error {
+	return func(_, _ string, c syscall.RawConn) error {
+		var sockErr error
+		if err := c.Control(func(fd uintptr) {
+			sockErr = unix.SetsockoptInt(int(fd), unix.SOL_SOCKET, unix.SO_USER_COOKIE, int(mark))
+		}); err != nil {
+			return err
+		}
+		return sockErr
+	}
+}
+
+// bindToDeviceControl is a no-op on FreeBSD: there is no SO_BINDTODEVICE
+// equivalent, callers rely on getListenIP resolving a source IP instead.
+func bindToDeviceControl(_ string) func(network, address string, c syscall.RawConn) error {
+	return func(string, string, syscall.RawConn) error { return nil }
+}
@@ -0,0 +1,54 @@
+package wireguard
+
+import (
+	"net"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// setSocketMark applies fwmark to conn's underlying socket via SO_MARK, the
+// same mechanism RoutingMark uses on Clash's other outbounds' sockets.
+func setSocketMark(conn *net.UDPConn, mark uint32) error {
+	rc, err := conn.SyscallConn()
+	if err != nil {
+		return err
+	}
+	var sockErr error
+	if err = rc.Control(func(fd uintptr) {
+		sockErr = unix.SetsockoptInt(int(fd), unix.SOL_SOCKET, unix.SO_MARK, int(mark))
+	}); err != nil {
+		return err
+	}
+	return sockErr
+}
+
+// markControl returns a dialer/listener Control function that applies mark
+// to a newly created socket before it's bound, so RoutingMark takes effect
+// on the very first packet rather than only after a later SetMark call.
+func markControl(mark uint32) func(network, address string, c syscall.RawConn) error {
+	return func(_, _ string, c syscall.RawConn) error {
+		var sockErr error
+		if err := c.Control(func(fd uintptr) {
+			sockErr = unix.SetsockoptInt(int(fd), unix.SOL_SOCKET, unix.SO_MARK, int(mark))
+		}); err != nil {
+			return err
+		}
+		return sockErr
+	}
+}
+
+// bindToDeviceControl returns a Control function that binds a newly created
+// socket to interfaceName via SO_BINDTODEVICE, for when the caller wants to
+// pin egress to a specific interface rather than only a source IP.
+func bindToDeviceControl(interfaceName string) func(network, address string, c syscall.RawConn) error {
+	return func(_, _ string, c syscall.RawConn) error {
+		var sockErr error
+		if err := c.Control(func(fd uintptr) {
+			sockErr = unix.BindToDevice(int(fd), interfaceName)
+		}); err != nil {
+			return err
+		}
+		return sockErr
+	}
+}
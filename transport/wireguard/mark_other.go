@@ -0,0 +1,21 @@
+//go:build !linux && !freebsd && !openbsd
+
+package wireguard
+
+import (
+	"net"
+	"syscall"
+)
+
+// setSocketMark is a no-op on platforms with no known fwmark equivalent.
+func setSocketMark(_ *net.UDPConn, _ uint32) error {
+	return nil
+}
+
+func markControl(_ uint32) func(network, address string, c syscall.RawConn) error {
+	return func(string, string, syscall.RawConn) error { return nil }
+}
+
+func bindToDeviceControl(_ string) func(network, address string, c syscall.RawConn) error {
+	return func(string, string, syscall.RawConn) error { return nil }
+}
@@ -0,0 +1,152 @@
+package wireguard
+
+import (
+	"net/netip"
+	"sync"
+	"time"
+)
+
+// candidateStat is what roamGroup knows about one candidate endpoint:
+// whether it's currently considered reachable (from real traffic or an
+// active probe), a recent round-trip estimate, and how many consecutive
+// times it's been the active candidate and gone quiet.
+type candidateStat struct {
+	lastSeen  time.Time
+	reachable bool
+	rtt       time.Duration
+	failures  int
+}
+
+// roamGroup tracks several candidate addresses for what device.Device still
+// treats as a single peer endpoint, and picks which one connectPool() actually
+// dials - the same multi-homing idea tailscale's magicsock uses for roaming
+// peers, layered on top of WgBind's existing per-endpoint wgConn pool
+// rather than replacing it.
+type roamGroup struct {
+	mu         sync.Mutex
+	candidates []netip.AddrPort
+	active     int
+	stats      []candidateStat
+}
+
+func newRoamGroup(candidates []netip.AddrPort) *roamGroup {
+	return &roamGroup{
+		candidates: candidates,
+		stats:      make([]candidateStat, len(candidates)),
+	}
+}
+
+// currentTarget returns the address connectPool() should dial right now.
+func (g *roamGroup) currentTarget() netip.AddrPort {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.candidates[g.active]
+}
+
+// allCandidates returns every candidate address, active or not, so a caller
+// can actively probe the ones that aren't carrying traffic right now.
+func (g *roamGroup) allCandidates() []netip.AddrPort {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	out := make([]netip.AddrPort, len(g.candidates))
+	copy(out, g.candidates)
+	return out
+}
+
+// markSeen resets addr's failure count and timestamps it as alive; called
+// from WgBind.readLoop whenever a datagram actually arrives from addr. rtt is an
+// estimate of the round trip that produced it (the time between the last
+// packet WgBind sent to addr and this reply), or 0 if that isn't known.
+func (g *roamGroup) markSeen(addr netip.AddrPort, rtt time.Duration) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	for i, c := range g.candidates {
+		if c == addr {
+			g.stats[i].lastSeen = time.Now()
+			g.stats[i].reachable = true
+			g.stats[i].failures = 0
+			if rtt > 0 {
+				g.stats[i].rtt = rtt
+			}
+			return
+		}
+	}
+}
+
+// markProbed records the outcome of an active reachability probe against
+// addr. WgBind can't complete a real WireGuard handshake itself - only
+// device.Device holds the session keys needed to build one - so this only
+// confirms the network path accepted a UDP write within the probe's
+// deadline, not that the peer itself answered; it's still useful as a
+// STUN-style "is anything listening here" check for candidates that aren't
+// currently carrying real traffic.
+func (g *roamGroup) markProbed(addr netip.AddrPort, reachable bool, rtt time.Duration) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	for i, c := range g.candidates {
+		if c == addr {
+			g.stats[i].reachable = reachable
+			if reachable && rtt > 0 {
+				g.stats[i].rtt = rtt
+			}
+			return
+		}
+	}
+}
+
+// degrade penalizes the active candidate and switches to the best
+// alternative: preferring one that's reachable, then the fewest consecutive
+// failures, then the lowest measured RTT, then whichever was most
+// recently seen. With only one other candidate to choose from - or several
+// that are all equally unreachable/untested - there's always exactly one
+// "best" to fail over to, so degrade always switches rather than getting
+// stuck re-picking the candidate it just marked bad; that in turn means
+// every candidate keeps getting retried instead of the bind wedging
+// permanently on one that's gone dead.
+func (g *roamGroup) degrade() (from, to netip.AddrPort, switched bool) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	from = g.candidates[g.active]
+	g.stats[g.active].failures++
+	g.stats[g.active].reachable = false
+
+	best := -1
+	for i := range g.candidates {
+		if i == g.active {
+			continue
+		}
+		if best == -1 || candidateHealthier(g.stats[i], g.stats[best]) {
+			best = i
+		}
+	}
+	if best == -1 {
+		// Only ever reached with a single-candidate group, which WgBind
+		// never constructs a roamGroup for in the first place.
+		return from, from, false
+	}
+
+	g.active = best
+	return from, g.candidates[best], true
+}
+
+// candidateHealthier reports whether a should be preferred over b as a
+// roam target.
+func candidateHealthier(a, b candidateStat) bool {
+	if a.reachable != b.reachable {
+		return a.reachable
+	}
+	if a.failures != b.failures {
+		return a.failures < b.failures
+	}
+	switch {
+	case a.rtt == 0 && b.rtt == 0:
+		// neither has a usable RTT sample yet
+	case a.rtt == 0:
+		return false
+	case b.rtt == 0:
+		return true
+	case a.rtt != b.rtt:
+		return a.rtt < b.rtt
+	}
+	return a.lastSeen.After(b.lastSeen)
+}
@@ -0,0 +1,23 @@
+// Package sticky parses and builds the ancillary (out-of-band) control
+// messages StdNetBind needs to keep WireGuard replies going out the same
+// local address and interface a peer's packets came in on. This matters on
+// multi-homed hosts and during roaming, where the OS routing table would
+// otherwise be free to pick a different egress for the reply.
+//
+// The OOB blob itself stays opaque to callers: each platform knows its own
+// cmsg layout (IP_PKTINFO on Linux and Windows, IP_RECVDSTADDR/IPV6_PKTINFO
+// on Darwin/BSD), so StdNetBind only ever deals with the Endpoint type below.
+package sticky
+
+import "net/netip"
+
+// Endpoint is the source address/interface Clash last saw traffic from a
+// given remote endpoint on.
+type Endpoint struct {
+	Src     netip.Addr
+	Ifindex int32
+}
+
+func (e Endpoint) IsValid() bool {
+	return e.Src.IsValid()
+}
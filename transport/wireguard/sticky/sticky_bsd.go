@@ -0,0 +1,69 @@
+//go:build darwin || dragonfly || freebsd || netbsd || openbsd
+
+package sticky
+
+import (
+	"net/netip"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// BSD/Darwin has no IP_PKTINFO for v4: IP_RECVDSTADDR/IP_SENDSRCADDR carry a
+// bare 4-byte in_addr with no interface index, so v4 sticky support here is
+// address-only. IPv6 does have IPV6_PKTINFO, same shape as Linux's.
+func ControlSize() int {
+	v4 := unix.CmsgSpace(4)
+	v6 := unix.CmsgSpace(unix.SizeofInet6Pktinfo)
+	if v6 > v4 {
+		return v6
+	}
+	return v4
+}
+
+func GetSrc(control []byte) Endpoint {
+	msgs, err := unix.ParseSocketControlMessage(control)
+	if err != nil {
+		return Endpoint{}
+	}
+	for _, m := range msgs {
+		switch {
+		case m.Header.Level == unix.IPPROTO_IP && m.Header.Type == unix.IP_RECVDSTADDR && len(m.Data) >= 4:
+			addr, ok := netip.AddrFromSlice(m.Data[:4])
+			if !ok {
+				continue
+			}
+			return Endpoint{Src: addr}
+		case m.Header.Level == unix.IPPROTO_IPV6 && m.Header.Type == unix.IPV6_PKTINFO && len(m.Data) >= unix.SizeofInet6Pktinfo:
+			info := (*unix.Inet6Pktinfo)(unsafe.Pointer(&m.Data[0]))
+			addr, ok := netip.AddrFromSlice(info.Addr[:])
+			if !ok {
+				continue
+			}
+			return Endpoint{Src: addr, Ifindex: int32(info.Ifindex)}
+		}
+	}
+	return Endpoint{}
+}
+
+func SetSrc(control []byte, ep Endpoint) []byte {
+	if !ep.IsValid() {
+		return control
+	}
+
+	if ep.Src.Is4() {
+		return setSrcV4(control, ep)
+	}
+
+	existing := len(control)
+	control = append(control, make([]byte, unix.CmsgSpace(unix.SizeofInet6Pktinfo))...)
+	hdr := (*unix.Cmsghdr)(unsafe.Pointer(&control[existing]))
+	hdr.Level = unix.IPPROTO_IPV6
+	hdr.Type = unix.IPV6_PKTINFO
+	hdr.SetLen(unix.CmsgLen(unix.SizeofInet6Pktinfo))
+
+	info := (*unix.Inet6Pktinfo)(unsafe.Pointer(&control[existing+unix.CmsgLen(0)]))
+	info.Ifindex = uint32(ep.Ifindex)
+	info.Addr = ep.Src.As16()
+	return control
+}
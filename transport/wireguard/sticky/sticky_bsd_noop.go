@@ -0,0 +1,12 @@
+//go:build darwin || dragonfly || netbsd
+
+package sticky
+
+// setSrcV4 is a no-op here: Darwin, NetBSD, and Dragonfly have no
+// IP_SENDSRCADDR (or equivalent) to stamp a v4 source address with, so
+// sticky v4 support on these platforms stays receive-only (GetSrc still
+// reports the address IP_RECVDSTADDR observed) - there's simply nothing to
+// send back to the kernel to request a specific v4 egress address.
+func setSrcV4(control []byte, _ Endpoint) []byte {
+	return control
+}
@@ -0,0 +1,25 @@
+//go:build freebsd || openbsd
+
+package sticky
+
+import (
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// setSrcV4 stamps an IP_SENDSRCADDR cmsg, the v4 "pick this source address"
+// control message FreeBSD and OpenBSD support. Darwin, NetBSD, and
+// Dragonfly don't define IP_SENDSRCADDR at all, so they get the no-op
+// fallback in sticky_bsd_noop.go instead.
+func setSrcV4(control []byte, ep Endpoint) []byte {
+	existing := len(control)
+	control = append(control, make([]byte, unix.CmsgSpace(4))...)
+	hdr := (*unix.Cmsghdr)(unsafe.Pointer(&control[existing]))
+	hdr.Level = unix.IPPROTO_IP
+	hdr.Type = unix.IP_SENDSRCADDR
+	hdr.SetLen(unix.CmsgLen(4))
+	as4 := ep.Src.As4()
+	copy(control[existing+unix.CmsgLen(0):], as4[:])
+	return control
+}
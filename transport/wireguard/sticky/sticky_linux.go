@@ -0,0 +1,83 @@
+package sticky
+
+import (
+	"net/netip"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// ControlSize is the OOB buffer size large enough to hold either an
+// IP_PKTINFO or an IPV6_PKTINFO control message.
+func ControlSize() int {
+	v4 := unix.CmsgSpace(unix.SizeofInet4Pktinfo)
+	v6 := unix.CmsgSpace(unix.SizeofInet6Pktinfo)
+	if v6 > v4 {
+		return v6
+	}
+	return v4
+}
+
+// GetSrc extracts the destination address/interface a received datagram's
+// control messages were tagged with - i.e. the local address the peer sent
+// to, which a reply should go back out of.
+func GetSrc(control []byte) Endpoint {
+	msgs, err := unix.ParseSocketControlMessage(control)
+	if err != nil {
+		return Endpoint{}
+	}
+	for _, m := range msgs {
+		switch {
+		case m.Header.Level == unix.IPPROTO_IP && m.Header.Type == unix.IP_PKTINFO && len(m.Data) >= unix.SizeofInet4Pktinfo:
+			info := (*unix.Inet4Pktinfo)(unsafe.Pointer(&m.Data[0]))
+			addr, ok := netip.AddrFromSlice(info.Spec_dst[:])
+			if !ok {
+				continue
+			}
+			return Endpoint{Src: addr, Ifindex: info.Ifindex}
+		case m.Header.Level == unix.IPPROTO_IPV6 && m.Header.Type == unix.IPV6_PKTINFO && len(m.Data) >= unix.SizeofInet6Pktinfo:
+			info := (*unix.Inet6Pktinfo)(unsafe.Pointer(&m.Data[0]))
+			addr, ok := netip.AddrFromSlice(info.Addr[:])
+			if !ok {
+				continue
+			}
+			return Endpoint{Src: addr, Ifindex: int32(info.Ifindex)}
+		}
+	}
+	return Endpoint{}
+}
+
+// SetSrc appends a control message instructing the kernel to send the next
+// datagram on this socket from ep.Src/ep.Ifindex, and returns the extended
+// buffer.
+func SetSrc(control []byte, ep Endpoint) []byte {
+	if !ep.IsValid() {
+		return control
+	}
+
+	if ep.Src.Is4() {
+		existing := len(control)
+		control = append(control, make([]byte, unix.CmsgSpace(unix.SizeofInet4Pktinfo))...)
+		hdr := (*unix.Cmsghdr)(unsafe.Pointer(&control[existing]))
+		hdr.Level = unix.IPPROTO_IP
+		hdr.Type = unix.IP_PKTINFO
+		hdr.SetLen(unix.CmsgLen(unix.SizeofInet4Pktinfo))
+
+		info := (*unix.Inet4Pktinfo)(unsafe.Pointer(&control[existing+unix.CmsgLen(0)]))
+		info.Ifindex = ep.Ifindex
+		info.Spec_dst = ep.Src.As4()
+		return control
+	}
+
+	existing := len(control)
+	control = append(control, make([]byte, unix.CmsgSpace(unix.SizeofInet6Pktinfo))...)
+	hdr := (*unix.Cmsghdr)(unsafe.Pointer(&control[existing]))
+	hdr.Level = unix.IPPROTO_IPV6
+	hdr.Type = unix.IPV6_PKTINFO
+	hdr.SetLen(unix.CmsgLen(unix.SizeofInet6Pktinfo))
+
+	info := (*unix.Inet6Pktinfo)(unsafe.Pointer(&control[existing+unix.CmsgLen(0)]))
+	info.Ifindex = uint32(ep.Ifindex)
+	info.Addr = ep.Src.As16()
+	return control
+}
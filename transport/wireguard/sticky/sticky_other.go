@@ -0,0 +1,11 @@
+//go:build !linux && !windows && !darwin && !dragonfly && !freebsd && !netbsd && !openbsd
+
+package sticky
+
+// ControlSize is 0 on platforms with no known sticky-source control message:
+// callers still work, they just can't pin the reply's source address.
+func ControlSize() int { return 0 }
+
+func GetSrc(_ []byte) Endpoint { return Endpoint{} }
+
+func SetSrc(control []byte, _ Endpoint) []byte { return control }
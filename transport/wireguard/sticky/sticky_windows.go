@@ -0,0 +1,108 @@
+//go:build windows
+
+package sticky
+
+import (
+	"encoding/binary"
+	"net/netip"
+)
+
+// These mirror the Windows SDK's ws2ipdef.h; golang.org/x/sys/windows
+// doesn't expose them as named constants.
+const (
+	windowsIPProtoIP   = 0
+	windowsIPProtoIPv6 = 41
+	windowsIPPktinfo   = 19
+	windowsIPv6Pktinfo = 19
+)
+
+// cmsghdr mirrors WSACMSGHDR: a length covering header+data, then the
+// level/type pair identifying the payload that follows.
+type cmsghdr struct {
+	Len   uint64
+	Level int32
+	Type  int32
+}
+
+const cmsghdrSize = 16 // unsafe.Sizeof(cmsghdr{}), 8-byte aligned
+
+func cmsgAlign(n int) int {
+	return (n + 7) &^ 7
+}
+
+func cmsgSpace(dataLen int) int {
+	return cmsghdrSize + cmsgAlign(dataLen)
+}
+
+// ControlSize is the OOB buffer size large enough to hold either an
+// IP_PKTINFO (8-byte in_pktinfo) or an IPV6_PKTINFO (20-byte in6_pktinfo)
+// WSA control message.
+func ControlSize() int {
+	v4 := cmsgSpace(8)
+	v6 := cmsgSpace(20)
+	if v6 > v4 {
+		return v6
+	}
+	return v4
+}
+
+func GetSrc(control []byte) Endpoint {
+	for len(control) >= cmsghdrSize {
+		var h cmsghdr
+		h.Len = binary.NativeEndian.Uint64(control[0:8])
+		h.Level = int32(binary.NativeEndian.Uint32(control[8:12]))
+		h.Type = int32(binary.NativeEndian.Uint32(control[12:16]))
+		if h.Len < cmsghdrSize || int(h.Len) > len(control) {
+			break
+		}
+		data := control[cmsghdrSize:h.Len]
+
+		switch {
+		case h.Level == windowsIPProtoIP && h.Type == windowsIPPktinfo && len(data) >= 8:
+			addr, ok := netip.AddrFromSlice(data[0:4])
+			if ok {
+				ifindex := binary.NativeEndian.Uint32(data[4:8])
+				return Endpoint{Src: addr, Ifindex: int32(ifindex)}
+			}
+		case h.Level == windowsIPProtoIPv6 && h.Type == windowsIPv6Pktinfo && len(data) >= 20:
+			addr, ok := netip.AddrFromSlice(data[0:16])
+			if ok {
+				ifindex := binary.NativeEndian.Uint32(data[16:20])
+				return Endpoint{Src: addr, Ifindex: int32(ifindex)}
+			}
+		}
+
+		control = control[cmsgAlign(int(h.Len)):]
+	}
+	return Endpoint{}
+}
+
+func SetSrc(control []byte, ep Endpoint) []byte {
+	if !ep.IsValid() {
+		return control
+	}
+
+	if ep.Src.Is4() {
+		dataLen := 8
+		existing := len(control)
+		control = append(control, make([]byte, cmsgSpace(dataLen))...)
+		binary.NativeEndian.PutUint64(control[existing:existing+8], uint64(cmsghdrSize+dataLen))
+		binary.NativeEndian.PutUint32(control[existing+8:existing+12], uint32(windowsIPProtoIP))
+		binary.NativeEndian.PutUint32(control[existing+12:existing+16], uint32(windowsIPPktinfo))
+		as4 := ep.Src.As4()
+		copy(control[existing+cmsghdrSize:], as4[:])
+		binary.NativeEndian.PutUint32(control[existing+cmsghdrSize+4:existing+cmsghdrSize+8], uint32(ep.Ifindex))
+		return control
+	}
+
+	dataLen := 20
+	existing := len(control)
+	control = append(control, make([]byte, cmsgSpace(dataLen))...)
+	binary.NativeEndian.PutUint64(control[existing:existing+8], uint64(cmsghdrSize+dataLen))
+	binary.NativeEndian.PutUint32(control[existing+8:existing+12], uint32(windowsIPProtoIPv6))
+	binary.NativeEndian.PutUint32(control[existing+12:existing+16], uint32(windowsIPv6Pktinfo))
+	as16 := ep.Src.As16()
+	copy(control[existing+cmsghdrSize:], as16[:])
+	binary.NativeEndian.PutUint32(control[existing+cmsghdrSize+16:existing+cmsghdrSize+20], uint32(ep.Ifindex))
+	return control
+}